@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"esxi_exporter/internal/config"
+	"esxi_exporter/internal/executor"
+	"esxi_exporter/internal/metrics"
+	"esxi_exporter/internal/models"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+	"time"
+)
+
+// Nagios plugin exit codes
+const (
+	checkOK = iota
+	checkWarning
+	checkCritical
+	checkUnknown
+)
+
+var checkStates = []string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+// threshold is a warning/critical pair; a zero bound is disabled
+type threshold struct {
+	warn, crit float64
+}
+
+// state returns the exit code of value against the thresholds
+func (t threshold) state(value float64) int {
+	switch {
+	case t.crit > 0 && value >= t.crit:
+		return checkCritical
+	case t.warn > 0 && value >= t.warn:
+		return checkWarning
+	}
+	return checkOK
+}
+
+// perfdata formats value with the thresholds as Nagios performance data
+func (t threshold) perfdata(label string, value float64) string {
+	bound := func(v float64) string {
+		if v <= 0 {
+			return ""
+		}
+		return fmt.Sprint(v)
+	}
+	return fmt.Sprintf("'%s'=%v;%s;%s", label, value, bound(t.warn), bound(t.crit))
+}
+
+// checkThresholds are the thresholds of `esxi_exporter check`
+type checkThresholds struct {
+	driveTemp, controllerTemp, reallocated, pending threshold
+}
+
+// checkResult accumulates the worst state, the problems and the perfdata
+type checkResult struct {
+	code     int
+	problems []string
+	perfdata []string
+}
+
+func (r *checkResult) add(code int, problem string) {
+	if code == checkOK {
+		return
+	}
+	if severity(code) > severity(r.code) {
+		r.code = code
+	}
+	r.problems = append(r.problems, checkStates[code]+": "+problem)
+}
+
+// severity ranks exit codes: UNKNOWN outranks OK only, so a failed
+// collector doesn't hide problems found by the others
+func severity(code int) int {
+	switch code {
+	case checkUnknown:
+		return 1
+	case checkWarning:
+		return 2
+	case checkCritical:
+		return 3
+	}
+	return 0
+}
+
+// runCheck implements `esxi_exporter check`: it collects the storage state
+// once, prints a Nagios/Icinga status line with perfdata and returns the
+// plugin exit code
+func runCheck(args []string) int {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	configFile := fs.String("config.file", "", "Path to the exporter configuration file")
+	collectorNames := fs.String("collectors", "storage,smart", "Comma-separated collectors to run")
+	timeout := fs.Duration("timeout", 50*time.Second, "Give up and return UNKNOWN after this long")
+	verbose := fs.Bool("verbose", false, "Log collector output to stderr")
+	th := checkThresholds{}
+	fs.Float64Var(&th.driveTemp.warn, "warn-temp", 50, "Drive temperature in Celsius to warn at, 0 disables")
+	fs.Float64Var(&th.driveTemp.crit, "crit-temp", 60, "Drive temperature in Celsius to go critical at, 0 disables")
+	fs.Float64Var(&th.controllerTemp.warn, "warn-controller-temp", 95, "Controller temperature in Celsius to warn at, 0 disables")
+	fs.Float64Var(&th.controllerTemp.crit, "crit-controller-temp", 105, "Controller temperature in Celsius to go critical at, 0 disables")
+	fs.Float64Var(&th.reallocated.warn, "warn-reallocated", 1, "Reallocated sectors to warn at, 0 disables")
+	fs.Float64Var(&th.reallocated.crit, "crit-reallocated", 100, "Reallocated sectors to go critical at, 0 disables")
+	fs.Float64Var(&th.pending.warn, "warn-pending", 1, "Pending sectors to warn at, 0 disables")
+	fs.Float64Var(&th.pending.crit, "crit-pending", 10, "Pending sectors to go critical at, 0 disables")
+	if err := fs.Parse(args); err != nil {
+		return checkUnknown
+	}
+
+	if !*verbose {
+		// Nagios reads the first line of output; keep collector logs out of it
+		log.SetOutput(ioutil.Discard)
+	}
+
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		fmt.Printf("ESXI UNKNOWN - loading config: %v\n", err)
+		return checkUnknown
+	}
+	pm, err := metrics.NewMetrics(cfg, executor.Local{}, strings.Split(*collectorNames, ","))
+	if err != nil {
+		fmt.Printf("ESXI UNKNOWN - %v\n", err)
+		return checkUnknown
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	pm.CollectMetrics(ctx)
+	if ctx.Err() != nil {
+		fmt.Printf("ESXI UNKNOWN - collection timed out after %v\n", *timeout)
+		return checkUnknown
+	}
+
+	code, output := check(pm, th)
+	fmt.Println(output)
+	return code
+}
+
+// check evaluates the collected storage state against the thresholds and
+// returns the plugin exit code and output
+func check(pm *metrics.Metrics, th checkThresholds) (int, string) {
+	result := &checkResult{}
+	health := pm.Health()
+	for _, p := range health.Problems {
+		code := checkWarning
+		if p.Severity == models.SeverityCritical {
+			code = checkCritical
+		}
+		if p.Component == "collector" {
+			// A failed collection leaves the state unknown rather than bad
+			code = checkUnknown
+		}
+		result.add(code, problemText(p))
+	}
+
+	inventory := pm.Inventory()
+	drives := 0
+	for _, c := range inventory.Controllers {
+		if c.TemperatureCelsius != nil {
+			label := "controller " + c.ID + " temperature"
+			result.add(th.controllerTemp.state(*c.TemperatureCelsius), fmt.Sprintf("%s is %v C", label, *c.TemperatureCelsius))
+			result.perfdata = append(result.perfdata, th.controllerTemp.perfdata(label, *c.TemperatureCelsius))
+		}
+		for _, d := range c.PhysicalDrives {
+			drives++
+			name := "drive " + c.ID + "/" + d.ID
+			if d.TemperatureCelsius != nil {
+				result.add(th.driveTemp.state(*d.TemperatureCelsius), fmt.Sprintf("%s temperature is %v C", name, *d.TemperatureCelsius))
+				result.perfdata = append(result.perfdata, th.driveTemp.perfdata(name+" temperature", *d.TemperatureCelsius))
+			}
+			if value, ok := d.Smart[metrics.SmartReallocatedSectors]; ok {
+				result.add(th.reallocated.state(value), fmt.Sprintf("%s has %v reallocated sectors", name, value))
+				result.perfdata = append(result.perfdata, th.reallocated.perfdata(name+" reallocated", value))
+			}
+			if value, ok := d.Smart[metrics.SmartPendingSectors]; ok {
+				result.add(th.pending.state(value), fmt.Sprintf("%s has %v pending sectors", name, value))
+				result.perfdata = append(result.perfdata, th.pending.perfdata(name+" pending", value))
+			}
+		}
+	}
+	if len(inventory.Controllers) == 0 && result.code == checkOK {
+		result.add(checkUnknown, "no storage controllers or drives found")
+	}
+
+	summary := fmt.Sprintf("%d controllers, %d drives", len(inventory.Controllers), drives)
+	if len(result.problems) > 0 {
+		summary = fmt.Sprintf("%d problems, %s", len(result.problems), summary)
+	}
+	lines := []string{fmt.Sprintf("ESXI %s - %s", checkStates[result.code], summary)}
+	if len(result.perfdata) > 0 {
+		lines[0] += " | " + strings.Join(result.perfdata, " ")
+	}
+	lines = append(lines, result.problems...)
+	return result.code, strings.Join(lines, "\n")
+}
+
+// problemText describes a health problem on one line
+func problemText(p models.Problem) string {
+	switch p.Component {
+	case "collector":
+		return p.ID + " " + p.Message
+	case "physical_drive", "virtual_drive", "enclosure":
+		return strings.Replace(p.Component, "_", " ", 1) + " " + p.Controller + "/" + p.ID + ": " + p.Message
+	}
+	return p.Component + " " + p.ID + ": " + p.Message
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"esxi_exporter/internal/config"
+	"esxi_exporter/internal/executor"
+	"esxi_exporter/internal/metrics"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestThresholdState(t *testing.T) {
+	for _, tc := range []struct {
+		t     threshold
+		value float64
+		want  int
+	}{
+		{threshold{50, 60}, 49, checkOK},
+		{threshold{50, 60}, 50, checkWarning},
+		{threshold{50, 60}, 59.9, checkWarning},
+		{threshold{50, 60}, 60, checkCritical},
+		{threshold{50, 60}, 75, checkCritical},
+		{threshold{0, 60}, 55, checkOK},
+		{threshold{0, 60}, 60, checkCritical},
+		{threshold{50, 0}, 75, checkWarning},
+		{threshold{0, 0}, 1000, checkOK},
+		{threshold{1, 100}, 0, checkOK},
+	} {
+		if got := tc.t.state(tc.value); got != tc.want {
+			t.Errorf("%+v.state(%v): got %s, want %s", tc.t, tc.value, checkStates[got], checkStates[tc.want])
+		}
+	}
+}
+
+func TestThresholdPerfdata(t *testing.T) {
+	for _, tc := range []struct {
+		t     threshold
+		label string
+		value float64
+		want  string
+	}{
+		{threshold{50, 60}, "drive 0/32:1 temperature", 61, "'drive 0/32:1 temperature'=61;50;60"},
+		{threshold{0, 0}, "a", 1, "'a'=1;;"},
+		{threshold{1, 0}, "drive 0/32:1 pending", 0, "'drive 0/32:1 pending'=0;1;"},
+		{threshold{0, 105}, "controller 0 temperature", 55.5, "'controller 0 temperature'=55.5;;105"},
+	} {
+		if got := tc.t.perfdata(tc.label, tc.value); got != tc.want {
+			t.Errorf("%+v.perfdata(%q, %v): got %q, want %q", tc.t, tc.label, tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestCheckResultAdd(t *testing.T) {
+	for _, tc := range []struct {
+		codes []int
+		want  int
+	}{
+		{nil, checkOK},
+		{[]int{checkOK}, checkOK},
+		{[]int{checkUnknown}, checkUnknown},
+		{[]int{checkWarning}, checkWarning},
+		{[]int{checkUnknown, checkWarning}, checkWarning},
+		{[]int{checkWarning, checkUnknown}, checkWarning},
+		{[]int{checkCritical, checkUnknown}, checkCritical},
+		{[]int{checkWarning, checkCritical, checkWarning}, checkCritical},
+		{[]int{checkOK, checkUnknown, checkOK}, checkUnknown},
+	} {
+		r := &checkResult{}
+		want := []string{}
+		for _, code := range tc.codes {
+			r.add(code, "problem")
+			if code != checkOK {
+				want = append(want, checkStates[code]+": problem")
+			}
+		}
+		if r.code != tc.want {
+			t.Errorf("%v: got %s, want %s", tc.codes, checkStates[r.code], checkStates[tc.want])
+		}
+		if strings.Join(r.problems, "\n") != strings.Join(want, "\n") {
+			t.Errorf("%v: got problems %q, want %q", tc.codes, r.problems, want)
+		}
+	}
+}
+
+// esxcliHost answers like a host without perccli: one SATA disk in esxcli,
+// read through smartctl
+type esxcliHost struct {
+	smartctl string
+}
+
+func (e esxcliHost) Run(ctx context.Context, command executor.Command) (string, error) {
+	switch command.String() {
+	case "esxcli --formatter=xml storage core device list":
+		return `[{"Device": "naa.5000c500a1b2c3d4", "DisplayName": "Local ATA Disk (naa.5000c500a1b2c3d4)", "Model": "ST4000NM0035-1V4", "IsSSD": false}]`, nil
+	case "/opt/smartmontools/smartctl -a -d sat /dev/disks/naa.5000c500a1b2c3d4":
+		return e.smartctl, nil
+	}
+	return "", fmt.Errorf("%s: not available", command)
+}
+
+func TestCheckSmartctlHost(t *testing.T) {
+	smartctl, err := ioutil.ReadFile("testdata/smartctl_sat.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm, err := metrics.NewMetrics(config.Default(), esxcliHost{string(smartctl)}, []string{"storage", "smart"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm.CollectMetrics(context.Background())
+
+	code, output := check(pm, checkThresholds{reallocated: threshold{1, 100}, pending: threshold{1, 10}})
+	want := "ESXI WARNING - 1 problems, 1 controllers, 1 drives | " +
+		"'drive esxcli/Local ATA Disk reallocated'=8;1;100 'drive esxcli/Local ATA Disk pending'=0;1;10\n" +
+		"WARNING: drive esxcli/Local ATA Disk has 8 reallocated sectors"
+	if code != checkWarning || output != want {
+		t.Errorf("got %s:\n%s\nwant WARNING:\n%s", checkStates[code], output, want)
+	}
+}
+
+// The fixture's hot spare (32:2) and unconfigured good drive (32:3) are
+// counted but raise no problem
+func TestCheckHotSpares(t *testing.T) {
+	code, output := check(newStorageMetrics(t), checkThresholds{controllerTemp: threshold{95, 105}})
+	want := "ESXI CRITICAL - 3 problems, 2 controllers, 5 drives | 'controller 0 temperature'=55;95;105\n" +
+		"CRITICAL: physical drive 0/Drive /c0/e32/s1: drive is not online\n" +
+		"CRITICAL: controller 1: controller is not optimal\n" +
+		"CRITICAL: virtual drive 1/DG0/VD0: virtual drive is not optimal"
+	if code != checkCritical || output != want {
+		t.Errorf("got %s:\n%s\nwant CRITICAL:\n%s", checkStates[code], output, want)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"esxi_exporter/internal/generate"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// runGenerate implements `esxi_exporter generate rules|dashboard`, writing
+// Prometheus alerting rules or a Grafana dashboard for the exported metrics
+func runGenerate(args []string) int {
+	fs := flag.NewFlagSet("generate", flag.ContinueOnError)
+	output := fs.String("output", "", "Write to this file instead of stdout")
+	opts := generate.DefaultRuleOptions
+	fs.Float64Var(&opts.DriveTemperature, "drive-temp", opts.DriveTemperature, "Drive temperature in Celsius to alert above")
+	fs.Float64Var(&opts.ControllerTemperature, "controller-temp", opts.ControllerTemperature, "Controller temperature in Celsius to alert above")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s generate [flags] rules|dashboard\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	var out []byte
+	var err error
+	switch fs.Arg(0) {
+	case "rules":
+		out, err = generate.Rules(opts)
+	case "dashboard":
+		out, err = generate.Dashboard()
+	default:
+		fs.Usage()
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error generating %s: %v\n", fs.Arg(0), err)
+		return 1
+	}
+
+	if *output == "" {
+		_, err = os.Stdout.Write(out)
+	} else {
+		err = ioutil.WriteFile(*output, out, 0644)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", fs.Arg(0), err)
+		return 1
+	}
+	return 0
+}
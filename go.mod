@@ -4,6 +4,13 @@ go 1.14
 
 require (
 	github.com/cespare/xxhash/v2 v2.1.2 // indirect
+	github.com/golang/protobuf v1.5.2 // indirect
+	github.com/golang/snappy v0.0.4
 	github.com/prometheus/client_golang v1.11.1
+	github.com/prometheus/client_model v0.2.0
 	github.com/prometheus/common v0.32.1 // indirect
+	github.com/prometheus/exporter-toolkit v0.7.3
+	golang.org/x/crypto v0.0.0-20210616213533-5ff15b29337e
+	google.golang.org/protobuf v1.28.1
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"esxi_exporter/internal/config"
+	"esxi_exporter/internal/executor"
+	"esxi_exporter/internal/metrics"
+	"esxi_exporter/internal/models"
+	"esxi_exporter/internal/probe"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// landingTemplate renders the index page with the status of each collector
+var landingTemplate = template.Must(template.New("landing").Parse(`<html>
+<head><title>ESXi Exporter</title></head>
+<body>
+<h1>ESXi Exporter</h1>
+<p><a href="/metrics">Metrics</a> &middot; <a href="/api/v1/inventory">Inventory</a> &middot; <a href="/api/v1/health">Health summary</a> &middot; <a href="/-/healthy">Health</a> &middot; <a href="/-/ready">Readiness</a></p>
+<h2>Collectors</h2>
+<table border="1" cellpadding="4">
+<tr><th>Collector</th><th>Last run</th><th>Duration</th><th>Status</th></tr>
+{{range .}}<tr>
+<td>{{.Name}}</td>
+{{if .LastRun.IsZero}}<td>never</td><td></td><td></td>{{else}}<td>{{.LastRun.Format "2006-01-02 15:04:05 MST"}}</td>
+<td>{{.Duration}}</td>
+<td>{{if .Err}}error: {{.Err}}{{else}}ok{{end}}</td>{{end}}
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// landingHandler serves the index page
+func landingHandler(pm *metrics.Metrics) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := landingTemplate.Execute(w, pm.Status()); err != nil {
+			log.Printf("Error rendering landing page: %v", err)
+		}
+	}
+}
+
+// healthyHandler reports that the process is up
+func healthyHandler(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("Healthy.\n"))
+}
+
+// readyHandler reports ready once the first collection has completed
+func readyHandler(pm *metrics.Metrics) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !pm.Ready() {
+			http.Error(w, "Waiting for the first collection.", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("Ready.\n"))
+	}
+}
+
+// driveStates are the states a physical drive can be in
+var driveStates = []string{models.StateOnline, models.StateSpare, models.StateUnconfiguredGood, models.StateOther}
+
+func validDriveState(state string) bool {
+	for _, s := range driveStates {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+// inventoryHandler serves the storage inventory as JSON. ?controller=
+// keeps one controller and ?drive_state= keeps the physical drives in
+// that state.
+func inventoryHandler(pm *metrics.Metrics) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		controllerID := r.URL.Query().Get("controller")
+		driveState := r.URL.Query().Get("drive_state")
+		if driveState != "" && !validDriveState(driveState) {
+			http.Error(w, "drive_state must be one of "+strings.Join(driveStates, ", ")+".", http.StatusBadRequest)
+			return
+		}
+
+		inventory := pm.Inventory()
+		controllers := []models.Controller{}
+		for _, c := range inventory.Controllers {
+			if controllerID != "" && c.ID != controllerID {
+				continue
+			}
+			if driveState != "" {
+				drives := []models.PhysicalDrive{}
+				for _, d := range c.PhysicalDrives {
+					if d.State == driveState {
+						drives = append(drives, d)
+					}
+				}
+				c.PhysicalDrives = drives
+			}
+			controllers = append(controllers, c)
+		}
+		inventory.Controllers = controllers
+		writeJSON(w, inventory)
+	}
+}
+
+// healthHandler serves the health summary as JSON. ?controller= keeps the
+// problems of one controller along with collector problems.
+func healthHandler(pm *metrics.Metrics) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		controllerID := r.URL.Query().Get("controller")
+
+		health := pm.Health()
+		if controllerID != "" {
+			problems := []models.Problem{}
+			for _, p := range health.Problems {
+				if p.Controller == "" || p.Controller == controllerID {
+					problems = append(problems, p)
+				}
+			}
+			health.Problems = problems
+			health.Status = metrics.WorstSeverity(problems)
+		}
+		writeJSON(w, health)
+	}
+}
+
+// writeJSON writes v as an indented JSON response
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		log.Printf("Error encoding JSON response: %v", err)
+	}
+}
+
+// reloader reloads the configuration file into the running exporter
+type reloader struct {
+	mtx          sync.Mutex
+	configFile   string
+	metrics      *metrics.Metrics
+	probeHandler *probe.Handler
+	pool         *executor.Pool
+}
+
+// reload reads the configuration file and applies it. Nothing is changed
+// when the file or its collector selection is invalid.
+func (r *reloader) reload() error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	cfg, err := config.Load(r.configFile)
+	if err != nil {
+		return err
+	}
+	if err := r.metrics.ApplyConfig(cfg, cfg.Collectors); err != nil {
+		return err
+	}
+	r.pool.SetTargets(cfg.Targets)
+	r.probeHandler.SetConfig(cfg)
+	log.Printf("Reloaded configuration from %q", r.configFile)
+	return nil
+}
+
+// ServeHTTP reloads the configuration on POST /-/reload
+func (r *reloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost && req.Method != http.MethodPut {
+		http.Error(w, "This endpoint requires a POST request.", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.reload(); err != nil {
+		log.Printf("Error reloading configuration: %v", err)
+		http.Error(w, "Failed to reload config: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"esxi_exporter/internal/config"
+	"esxi_exporter/internal/executor"
+	"esxi_exporter/internal/metrics"
+	"esxi_exporter/internal/models"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// perccliExecutor answers `perccli /cALL show all J` from a fixture and
+// fails every other command, so only the perccli families are collected
+type perccliExecutor struct {
+	showAll string
+}
+
+func (e perccliExecutor) Run(ctx context.Context, command executor.Command) (string, error) {
+	if strings.HasSuffix(command.String(), "/perccli /cALL show all J") {
+		return e.showAll, nil
+	}
+	return "", fmt.Errorf("%s: not available", command)
+}
+
+// newStorageMetrics collects the storage collector against the perccli fixture
+func newStorageMetrics(t *testing.T) *metrics.Metrics {
+	t.Helper()
+	showAll, err := ioutil.ReadFile("testdata/perccli_show_all.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm, err := metrics.NewMetrics(config.Default(), perccliExecutor{string(showAll)}, []string{"storage"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm.CollectMetrics(context.Background())
+	return pm
+}
+
+// get serves url through h and decodes a 200 response into v
+func get(t *testing.T, h http.Handler, url string, v interface{}) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %s: got status %d: %s", url, rec.Code, rec.Body)
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+}
+
+// driveIDs lists the physical drives of each controller as "controller:drive"
+func driveIDs(inventory models.Inventory) []string {
+	ids := []string{}
+	for _, c := range inventory.Controllers {
+		for _, d := range c.PhysicalDrives {
+			ids = append(ids, c.ID+":"+d.ID)
+		}
+	}
+	return ids
+}
+
+func TestInventoryHandler(t *testing.T) {
+	h := inventoryHandler(newStorageMetrics(t))
+
+	var inventory models.Inventory
+	get(t, h, "/api/v1/inventory", &inventory)
+	if inventory.SchemaVersion != models.SchemaVersion {
+		t.Errorf("got schema_version %d, want %d", inventory.SchemaVersion, models.SchemaVersion)
+	}
+	if len(inventory.Controllers) != 2 {
+		t.Fatalf("got %d controllers, want 2", len(inventory.Controllers))
+	}
+	c := inventory.Controllers[0]
+	if c.ID != "0" || c.Source != "perccli" || c.Model != "PERC H730P Mini" || c.Serial != "5CF0123" || c.FirmwareVersion != "4.300.00-8366" {
+		t.Errorf("got controller %+v", c)
+	}
+	if c.State != models.StateOptimal || c.TemperatureCelsius == nil || *c.TemperatureCelsius != 55 {
+		t.Errorf("got controller 0 state %q, temperature %v", c.State, c.TemperatureCelsius)
+	}
+	if c.BBU == nil || c.BBU.State != models.StateHealthy {
+		t.Errorf("got BBU %+v, want healthy", c.BBU)
+	}
+	if len(c.VirtualDrives) != 1 || c.VirtualDrives[0].ID != "DG0/VD0" || c.VirtualDrives[0].State != models.StateOptimal {
+		t.Errorf("got virtual drives %+v", c.VirtualDrives)
+	}
+	if inventory.Controllers[1].State != models.StateOther || inventory.Controllers[1].BBU != nil {
+		t.Errorf("got controller 1 %+v, want state other and no BBU", inventory.Controllers[1])
+	}
+
+	for _, tc := range []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"0:Drive /c0/e32/s0", "0:Drive /c0/e32/s1", "0:Drive /c0/e32/s2", "0:Drive /c0/e32/s3", "1:Drive /c1/e8/s0"}},
+		{"?controller=1", []string{"1:Drive /c1/e8/s0"}},
+		{"?drive_state=online", []string{"0:Drive /c0/e32/s0", "1:Drive /c1/e8/s0"}},
+		{"?drive_state=spare", []string{"0:Drive /c0/e32/s2"}},
+		{"?drive_state=unconfigured_good", []string{"0:Drive /c0/e32/s3"}},
+		{"?drive_state=other", []string{"0:Drive /c0/e32/s1"}},
+		{"?controller=0&drive_state=other", []string{"0:Drive /c0/e32/s1"}},
+		{"?controller=2", []string{}},
+	} {
+		var inventory models.Inventory
+		get(t, h, "/api/v1/inventory"+tc.query, &inventory)
+		if got := driveIDs(inventory); strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("%q: got drives %q, want %q", tc.query, got, tc.want)
+		}
+	}
+}
+
+func TestInventoryHandlerRejectsUnknownDriveState(t *testing.T) {
+	h := inventoryHandler(newStorageMetrics(t))
+	for _, state := range []string{"Onln", "GHS", "offline", "optimal"} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/inventory?drive_state="+state, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("drive_state=%s: got status %d, want 400", state, rec.Code)
+		}
+	}
+}
+
+func TestHealthHandler(t *testing.T) {
+	h := healthHandler(newStorageMetrics(t))
+
+	for _, tc := range []struct {
+		query  string
+		status string
+		want   []string
+	}{
+		{"", models.SeverityCritical, []string{
+			"physical_drive 0/Drive /c0/e32/s1",
+			"controller 1/1",
+			"virtual_drive 1/DG0/VD0",
+		}},
+		{"?controller=0", models.SeverityCritical, []string{"physical_drive 0/Drive /c0/e32/s1"}},
+		{"?controller=2", "ok", []string{}},
+	} {
+		var health models.Health
+		get(t, h, "/api/v1/health"+tc.query, &health)
+		if health.SchemaVersion != models.SchemaVersion {
+			t.Errorf("%q: got schema_version %d, want %d", tc.query, health.SchemaVersion, models.SchemaVersion)
+		}
+		if health.Status != tc.status {
+			t.Errorf("%q: got status %q, want %q", tc.query, health.Status, tc.status)
+		}
+		got := []string{}
+		for _, p := range health.Problems {
+			got = append(got, p.Component+" "+p.Controller+"/"+p.ID)
+		}
+		if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("%q: got problems %q, want %q", tc.query, got, tc.want)
+		}
+	}
+}
+
+// Bumping the schema version breaks API clients; do it on purpose
+func TestSchemaVersion(t *testing.T) {
+	pm := newStorageMetrics(t)
+	for url, h := range map[string]http.Handler{
+		"/api/v1/inventory": inventoryHandler(pm),
+		"/api/v1/health":    healthHandler(pm),
+	} {
+		var document map[string]interface{}
+		get(t, h, url, &document)
+		if version, ok := document["schema_version"].(float64); !ok || version != 1 {
+			t.Errorf("%s: got schema_version %v, want 1", url, document["schema_version"])
+		}
+	}
+}
@@ -0,0 +1,175 @@
+// Package config loads the exporter configuration file.
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Config is the root of the configuration file
+type Config struct {
+	// Collectors run for the local host. An empty list runs every collector
+	// (vcenter only when configured).
+	Collectors []string                `yaml:"collectors"`
+	Modules    map[string]ModuleConfig `yaml:"modules"`
+	Targets    map[string]TargetConfig `yaml:"targets"`
+	Esxtop     EsxtopConfig            `yaml:"esxtop"`
+	Vcenter    VcenterConfig           `yaml:"vcenter"`
+	Wbem       WbemConfig              `yaml:"wbem"`
+	Redfish    RedfishConfig           `yaml:"redfish"`
+	Smart      SmartConfig             `yaml:"smart"`
+	// StaleAfter is the age after which the served metrics are flagged
+	// with esxi_metrics_stale. Zero disables the flag.
+	StaleAfter time.Duration `yaml:"stale_after"`
+	// CommandTimeout bounds every command run on a host
+	CommandTimeout time.Duration `yaml:"command_timeout"`
+	// Schedules overrides the default interval and jitter of collectors by name
+	Schedules map[string]ScheduleConfig `yaml:"schedules"`
+}
+
+// ScheduleConfig controls how often a collector runs
+type ScheduleConfig struct {
+	Interval time.Duration `yaml:"interval"`
+	// Jitter is the upper bound of a random delay added to each interval
+	// so hosts don't run their collectors in lockstep
+	Jitter time.Duration `yaml:"jitter"`
+}
+
+// ModuleConfig selects the collectors run for a /probe module
+type ModuleConfig struct {
+	Collectors []string `yaml:"collectors"`
+}
+
+// TargetConfig holds the SSH credentials of a remote ESXi host probed via /probe
+type TargetConfig struct {
+	// Address is host:port to dial, defaulting to the target name on port 22
+	Address               string `yaml:"address"`
+	User                  string `yaml:"user"`
+	PrivateKeyFile        string `yaml:"private_key_file"`
+	KnownHostsFile        string `yaml:"known_hosts_file"`
+	InsecureIgnoreHostKey bool   `yaml:"insecure_ignore_host_key"`
+	// Redfish is the BMC of the target, used by the redfish collector when
+	// the target is probed
+	Redfish RedfishConfig `yaml:"redfish"`
+}
+
+// EsxtopConfig controls the esxtop batch mode collector
+type EsxtopConfig struct {
+	// Counters is the allow-list of esxtop counters to export. An empty
+	// list exports every counter the collector knows about.
+	Counters []string `yaml:"counters"`
+}
+
+// EsxtopCounters lists the names accepted in esxtop.counters, one per
+// counter the esxtop collector exports
+var EsxtopCounters = []string{
+	"cpu_util", "memory_free", "memory_active",
+	"device_davg", "device_kavg", "device_gavg", "device_qavg",
+	"device_active", "device_queued", "device_commands", "device_reads", "device_writes",
+}
+
+// SmartConfig bounds the per-drive commands of the smart collector
+type SmartConfig struct {
+	// Workers is the number of drives read at once across all controllers
+	Workers int `yaml:"workers"`
+	// PerController caps the drives read at once on a single controller so
+	// the RAID firmware isn't overloaded
+	PerController int `yaml:"per_controller"`
+	// Timeout bounds a whole SMART collection; drives not read by then are
+	// skipped
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// VcenterConfig enables fleet-wide collection from a vCenter Server
+type VcenterConfig struct {
+	// URL of the vCenter Server, e.g. https://vcenter.example.com. The
+	// vCenter collector is disabled when empty.
+	URL                string `yaml:"url"`
+	Username           string `yaml:"username"`
+	Password           string `yaml:"password"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+	// VimRelease is the vSphere release used in /sdk/vim25/{release} paths
+	// when reading triggered alarms.
+	VimRelease string `yaml:"vim_release"`
+}
+
+// WbemConfig enables hardware health collection from the host CIM server
+type WbemConfig struct {
+	// URL of the CIM server, e.g. https://localhost:5989. The wbem collector
+	// is disabled when empty.
+	URL                string `yaml:"url"`
+	Username           string `yaml:"username"`
+	Password           string `yaml:"password"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+	Namespace          string `yaml:"namespace"`
+}
+
+// RedfishConfig enables out-of-band collection from the host BMC (iDRAC)
+type RedfishConfig struct {
+	// URL of the Redfish service, e.g. https://idrac-esx01.example.com. The
+	// redfish collector is disabled when empty.
+	URL                string `yaml:"url"`
+	Username           string `yaml:"username"`
+	Password           string `yaml:"password"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+// Default returns the configuration used when no file is given
+func Default() *Config {
+	return &Config{
+		StaleAfter:     48 * time.Hour,
+		CommandTimeout: 30 * time.Second,
+		Smart: SmartConfig{
+			Workers:       4,
+			PerController: 2,
+			Timeout:       5 * time.Minute,
+		},
+		Vcenter: VcenterConfig{
+			VimRelease: "8.0.1.0",
+		},
+		Wbem: WbemConfig{
+			Namespace: "root/cimv2",
+		},
+	}
+}
+
+// Load reads the configuration file at path. An empty path yields the defaults.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %v", err)
+	}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("parsing config file %s: %v", path, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// validate rejects settings the collectors would only fail on at run time
+func (c *Config) validate() error {
+	for _, name := range c.Esxtop.Counters {
+		known := false
+		for _, counter := range EsxtopCounters {
+			if name == counter {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown esxtop counter %q, known counters: %s", name, strings.Join(EsxtopCounters, ", "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+// Package esxcli decodes the structured output of `esxcli --formatter=xml`
+// and `esxcli --formatter=json` into flat records.
+package esxcli
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Record is one esxcli structure flattened to field name/value pairs.
+// Nested structures use dotted keys ("Parent.Child") and lists of scalars
+// are joined with commas.
+type Record map[string]string
+
+// Get returns the value of key or defaultValue when the field is missing
+func (r Record) Get(key, defaultValue string) string {
+	if val, ok := r[key]; ok && val != "" {
+		return val
+	}
+	return defaultValue
+}
+
+// First returns the first non-empty field among keys. Several field names
+// changed between ESXi releases.
+func (r Record) First(defaultValue string, keys ...string) string {
+	for _, key := range keys {
+		if val := r.Get(key, ""); val != "" {
+			return val
+		}
+	}
+	return defaultValue
+}
+
+// Float parses the value of key as a number
+func (r Record) Float(key string) (float64, bool) {
+	val, ok := r[key]
+	if !ok {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+	if err != nil {
+		return 0, false
+	}
+	return f, true
+}
+
+// Bool reports whether key holds an esxcli true value
+func (r Record) Bool(key string) bool {
+	return strings.EqualFold(strings.TrimSpace(r[key]), "true")
+}
+
+// Decode parses esxcli output produced with either the xml or the json
+// formatter. List commands yield one record per structure, the `get`
+// commands yield a single record.
+func Decode(output []byte) ([]Record, error) {
+	trimmed := bytes.TrimSpace(output)
+	if len(trimmed) == 0 {
+		return nil, nil
+	}
+	switch trimmed[0] {
+	case '<':
+		return decodeXML(trimmed)
+	case '[', '{':
+		return decodeJSON(trimmed)
+	}
+	return nil, fmt.Errorf("esxcli: unrecognised output format")
+}
+
+// xmlNode is a generic element of the esxcli xml formatter output
+type xmlNode struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Content string     `xml:",chardata"`
+	Nodes   []xmlNode  `xml:",any"`
+}
+
+func (n *xmlNode) attr(name string) string {
+	for _, a := range n.Attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func decodeXML(data []byte) ([]Record, error) {
+	var doc xmlNode
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("esxcli: decoding xml: %v", err)
+	}
+
+	root := &doc
+	if root.XMLName.Local == "output" {
+		for i := range doc.Nodes {
+			if doc.Nodes[i].XMLName.Local == "root" {
+				root = &doc.Nodes[i]
+				break
+			}
+		}
+	}
+	if len(root.Nodes) == 0 {
+		return nil, nil
+	}
+
+	value := &root.Nodes[0]
+	switch value.XMLName.Local {
+	case "structure":
+		record := Record{}
+		flattenXMLStructure(record, "", value)
+		return []Record{record}, nil
+	case "list":
+		records := []Record{}
+		for i := range value.Nodes {
+			item := &value.Nodes[i]
+			record := Record{}
+			if item.XMLName.Local == "structure" {
+				flattenXMLStructure(record, "", item)
+			} else {
+				record["Value"] = strings.TrimSpace(item.Content)
+			}
+			records = append(records, record)
+		}
+		return records, nil
+	default:
+		return []Record{{"Value": strings.TrimSpace(value.Content)}}, nil
+	}
+}
+
+func flattenXMLStructure(record Record, prefix string, structure *xmlNode) {
+	for i := range structure.Nodes {
+		field := &structure.Nodes[i]
+		if field.XMLName.Local != "field" || len(field.Nodes) == 0 {
+			continue
+		}
+		key := prefix + field.attr("name")
+		value := &field.Nodes[0]
+		switch value.XMLName.Local {
+		case "structure":
+			flattenXMLStructure(record, key+".", value)
+		case "list":
+			items := make([]string, 0, len(value.Nodes))
+			for _, item := range value.Nodes {
+				if item.XMLName.Local == "structure" {
+					continue
+				}
+				items = append(items, strings.TrimSpace(item.Content))
+			}
+			record[key] = strings.Join(items, ",")
+		default:
+			record[key] = strings.TrimSpace(value.Content)
+		}
+	}
+}
+
+func decodeJSON(data []byte) ([]Record, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("esxcli: decoding json: %v", err)
+	}
+
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		record := Record{}
+		flattenJSONObject(record, "", v)
+		return []Record{record}, nil
+	case []interface{}:
+		records := []Record{}
+		for _, item := range v {
+			record := Record{}
+			if obj, ok := item.(map[string]interface{}); ok {
+				flattenJSONObject(record, "", obj)
+			} else {
+				record["Value"] = jsonScalar(item)
+			}
+			records = append(records, record)
+		}
+		return records, nil
+	}
+	return []Record{{"Value": jsonScalar(doc)}}, nil
+}
+
+func flattenJSONObject(record Record, prefix string, obj map[string]interface{}) {
+	for name, value := range obj {
+		key := prefix + name
+		switch v := value.(type) {
+		case map[string]interface{}:
+			flattenJSONObject(record, key+".", v)
+		case []interface{}:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				if _, ok := item.(map[string]interface{}); ok {
+					continue
+				}
+				items = append(items, jsonScalar(item))
+			}
+			record[key] = strings.Join(items, ",")
+		default:
+			record[key] = jsonScalar(v)
+		}
+	}
+}
+
+func jsonScalar(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,109 @@
+package esxcli
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		want []Record
+	}{
+		{"device_list", []Record{
+			{
+				"Device":      "naa.600508b1001c4d41",
+				"DisplayName": "Local DELL Disk (naa.600508b1001c4d41)",
+				"IsSSD":       "false",
+				"Size":        "915683",
+				"OtherUIDs":   "vml.0200000000600508b1001c4d41,vml.0300000000600508b1001c4d41",
+				"Queue.Depth": "64",
+				"Queue.Full":  "true",
+			},
+			{
+				"Device":      "t10.ATA_MZ7LH480",
+				"DisplayName": "Local ATA Disk (t10.ATA_MZ7LH480)",
+				"IsSSD":       "true",
+				"Size":        "457862",
+				"OtherUIDs":   "",
+				"Queue.Depth": "31",
+				"Queue.Full":  "false",
+			},
+		}},
+		{"hostname_get", []Record{{
+			"DomainName":               "example.com",
+			"FullyQualifiedDomainName": "esx01.example.com",
+			"HostName":                 "esx01",
+		}}},
+		{"module_list", []Record{{"Value": "lsi_mr3"}, {"Value": "nvme_pcie"}}},
+	} {
+		for _, format := range []string{"xml", "json"} {
+			output, err := ioutil.ReadFile(filepath.Join("testdata", tc.name+"."+format))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Decode(output)
+			if err != nil {
+				t.Errorf("%s.%s: %v", tc.name, format, err)
+				continue
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("%s.%s: got %v, want %v", tc.name, format, got, tc.want)
+			}
+		}
+	}
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	for _, output := range []string{
+		`<output><root><list type="structure"><structure>`,
+		`<output><root></list></root></output>`,
+		`[{"Device": "naa.1"`,
+		`{"Device": naa.1}`,
+		`Error: Unknown command or namespace storage core devices list`,
+	} {
+		if records, err := Decode([]byte(output)); err == nil {
+			t.Errorf("Decode(%q) = %v, want an error", output, records)
+		}
+	}
+}
+
+func TestDecodeEmpty(t *testing.T) {
+	for _, output := range []string{"", "  \n", `<output><root></root></output>`} {
+		records, err := Decode([]byte(output))
+		if err != nil || len(records) != 0 {
+			t.Errorf("Decode(%q) = %v, %v, want no records", output, records, err)
+		}
+	}
+}
+
+func TestRecordValues(t *testing.T) {
+	records, err := Decode([]byte(`<output><root><structure>
+		<field name="IsSSD"><boolean>true</boolean></field>
+		<field name="IsLocal"><boolean>false</boolean></field>
+		<field name="Size"><integer>915683</integer></field>
+		<field name="Vendor"><string></string></field>
+		<field name="Model"><string>PERC H730P Mini</string></field>
+	</structure></root></output>`))
+	if err != nil || len(records) != 1 {
+		t.Fatalf("got %v, %v", records, err)
+	}
+	r := records[0]
+	if !r.Bool("IsSSD") || r.Bool("IsLocal") || r.Bool("Missing") {
+		t.Errorf("got IsSSD=%v IsLocal=%v Missing=%v, want true false false", r.Bool("IsSSD"), r.Bool("IsLocal"), r.Bool("Missing"))
+	}
+	if size, ok := r.Float("Size"); !ok || size != 915683 {
+		t.Errorf("got Size %v, %v, want 915683", size, ok)
+	}
+	if _, ok := r.Float("Model"); ok {
+		t.Error("parsed Model as a number")
+	}
+	if got := r.Get("Vendor", "Unknown"); got != "Unknown" {
+		t.Errorf("got empty Vendor as %q, want the default", got)
+	}
+	if got := r.First("Unknown", "Vendor", "Model"); got != "PERC H730P Mini" {
+		t.Errorf("got First %q, want the model", got)
+	}
+}
@@ -0,0 +1,116 @@
+// Package executor runs the perccli, esxcli and smartctl commands used by
+// the collectors, either on the local host or on a remote ESXi host.
+package executor
+
+import (
+	"bytes"
+	"context"
+	"esxi_exporter/internal/models"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// maxOutputSize caps the stdout kept from a command; perccli JSON of a
+// fully populated chassis stays well below it
+const maxOutputSize = 32 << 20
+
+// maxStderrSize caps the stderr kept for error messages
+const maxStderrSize = 64 << 10
+
+// Command is a program and its arguments, run without a shell so that
+// arguments taken from command output can't inject commands
+type Command struct {
+	// Dir is the working directory, the executor's own when empty
+	Dir  string
+	Args []string
+}
+
+func (c Command) String() string {
+	return strings.Join(c.Args, " ")
+}
+
+// Executor runs commands on an ESXi host. Commands are killed once ctx is
+// done. The captured output is returned along with a *models.CommandError
+// when the command fails; executors don't log failures, since a non-zero
+// exit is expected from some commands (smartctl's status bit mask) and
+// callers decide.
+type Executor interface {
+	Run(ctx context.Context, command Command) (string, error)
+}
+
+// Local runs commands on the host the exporter runs on
+type Local struct{}
+
+// Run executes a command in its own process group, killing the whole
+// group (perccli, smartctl and any children) once ctx is done
+func (Local) Run(ctx context.Context, command Command) (string, error) {
+	if len(command.Args) == 0 {
+		return "", fmt.Errorf("empty command")
+	}
+	cmd := exec.Command(command.Args[0], command.Args[1:]...)
+	cmd.Dir = command.Dir
+	output := &limitedBuffer{limit: maxOutputSize}
+	stderr := &limitedBuffer{limit: maxStderrSize}
+	cmd.Stdout = output
+	cmd.Stderr = stderr
+	setProcessGroup(cmd)
+
+	if err := cmd.Start(); err != nil {
+		return "", &models.CommandError{Command: command.String(), ExitCode: -1, Message: err.Error()}
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case <-ctx.Done():
+		killProcessGroup(cmd)
+		<-done
+		return "", contextError(ctx, command.String(), stderr.String())
+	case err := <-done:
+		if err != nil {
+			exitCode := -1
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				exitCode = exitErr.ExitCode()
+			}
+			return output.String(), &models.CommandError{Command: command.String(), ExitCode: exitCode, Stderr: stderr.String(), Message: err.Error()}
+		}
+		if output.truncated {
+			return "", &models.CommandError{Command: command.String(), Message: fmt.Sprintf("output exceeded %d bytes", maxOutputSize)}
+		}
+		return output.String(), nil
+	}
+}
+
+// contextError describes a command killed because ctx is done
+func contextError(ctx context.Context, command, stderr string) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return &models.CommandError{Command: command, ExitCode: -1, Stderr: stderr, Message: "command timed out", TimedOut: true}
+	}
+	return &models.CommandError{Command: command, ExitCode: -1, Stderr: stderr, Message: "command cancelled"}
+}
+
+// limitedBuffer keeps the first limit bytes written to it and discards the rest
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); len(p) > room {
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		b.truncated = true
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) String() string {
+	return b.buf.String()
+}
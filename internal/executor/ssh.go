@@ -0,0 +1,327 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"esxi_exporter/internal/config"
+	"esxi_exporter/internal/models"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Pool keeps one SSH connection per configured target and hands out
+// executors running commands over them
+type Pool struct {
+	mtx     sync.Mutex
+	targets map[string]config.TargetConfig
+	clients map[string]*ssh.Client
+	dials   map[string]*dialCall
+}
+
+// dialCall is a connection attempt in progress, shared by the commands
+// waiting for the same target
+type dialCall struct {
+	done   chan struct{}
+	client *ssh.Client
+	err    error
+}
+
+// NewPool creates a pool for the given targets
+func NewPool(targets map[string]config.TargetConfig) *Pool {
+	return &Pool{
+		targets: targets,
+		clients: make(map[string]*ssh.Client),
+		dials:   make(map[string]*dialCall),
+	}
+}
+
+// Executor returns an executor for a configured target
+func (p *Pool) Executor(target string) (Executor, error) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if _, ok := p.targets[target]; !ok {
+		return nil, fmt.Errorf("unknown target %q", target)
+	}
+	return &SSH{pool: p, target: target}, nil
+}
+
+// SetTargets replaces the configured targets, closing connections to
+// targets that were removed or whose settings changed
+func (p *Pool) SetTargets(targets map[string]config.TargetConfig) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	for target, client := range p.clients {
+		if newCfg, ok := targets[target]; !ok || !reflect.DeepEqual(newCfg, p.targets[target]) {
+			client.Close()
+			delete(p.clients, target)
+		}
+	}
+	p.targets = targets
+}
+
+// Close closes every pooled connection
+func (p *Pool) Close() {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	for target, client := range p.clients {
+		client.Close()
+		delete(p.clients, target)
+	}
+}
+
+// client returns the pooled connection to target, dialing it if needed.
+// Dialing happens outside the lock so an unreachable target doesn't hold
+// up commands to the others.
+func (p *Pool) client(target string) (*ssh.Client, error) {
+	p.mtx.Lock()
+	if client, ok := p.clients[target]; ok {
+		p.mtx.Unlock()
+		return client, nil
+	}
+	if call, ok := p.dials[target]; ok {
+		p.mtx.Unlock()
+		<-call.done
+		return call.client, call.err
+	}
+	call := &dialCall{done: make(chan struct{})}
+	p.dials[target] = call
+	cfg := p.targets[target]
+	p.mtx.Unlock()
+
+	client, err := dial(target, cfg)
+
+	p.mtx.Lock()
+	delete(p.dials, target)
+	if err == nil {
+		if current, ok := p.targets[target]; ok && reflect.DeepEqual(current, cfg) {
+			p.clients[target] = client
+		} else {
+			// SetTargets changed or removed the target while dialing
+			client.Close()
+			client, err = nil, fmt.Errorf("target %s was reconfigured while connecting", target)
+		}
+	}
+	call.client, call.err = client, err
+	p.mtx.Unlock()
+	close(call.done)
+	return client, err
+}
+
+// drop closes and forgets a broken connection so the next command redials
+func (p *Pool) drop(target string, client *ssh.Client) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if p.clients[target] == client {
+		delete(p.clients, target)
+	}
+	client.Close()
+}
+
+func dial(target string, cfg config.TargetConfig) (*ssh.Client, error) {
+	key, err := ioutil.ReadFile(cfg.PrivateKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading private key for %s: %v", target, err)
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("parsing private key for %s: %v", target, err)
+	}
+
+	var hostKeyCallback ssh.HostKeyCallback
+	switch {
+	case cfg.KnownHostsFile != "":
+		hostKeyCallback, err = knownhosts.New(cfg.KnownHostsFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading known hosts for %s: %v", target, err)
+		}
+	case cfg.InsecureIgnoreHostKey:
+		hostKeyCallback = ssh.InsecureIgnoreHostKey()
+	default:
+		return nil, fmt.Errorf("target %s needs known_hosts_file or insecure_ignore_host_key", target)
+	}
+
+	address := cfg.Address
+	if address == "" {
+		address = target
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, "22")
+	}
+	user := cfg.User
+	if user == "" {
+		user = "root"
+	}
+
+	return ssh.Dial("tcp", address, &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         10 * time.Second,
+	})
+}
+
+// SSH runs commands on a remote ESXi host over a pooled connection
+type SSH struct {
+	pool   *Pool
+	target string
+}
+
+// killTimeout bounds the session killing a cancelled remote command
+const killTimeout = 5 * time.Second
+
+// Run executes a command on the remote host. sshd always runs commands
+// through the login shell, so every argument is quoted. sshd ignores
+// signals sent over the session and closing it leaves the command running,
+// so the shell reports its PID before exec'ing the command, and once ctx is
+// done the command's process group is killed from a second session.
+func (s *SSH) Run(ctx context.Context, command Command) (string, error) {
+	if len(command.Args) == 0 {
+		return "", fmt.Errorf("empty command")
+	}
+	client, err := s.pool.client(s.target)
+	if err != nil {
+		return "", err
+	}
+	session, err := client.NewSession()
+	if err != nil {
+		// The pooled connection went away (host reboot, sshd restart); redial once
+		s.pool.drop(s.target, client)
+		if client, err = s.pool.client(s.target); err != nil {
+			return "", err
+		}
+		if session, err = client.NewSession(); err != nil {
+			return "", err
+		}
+	}
+	defer session.Close()
+
+	output := &limitedBuffer{limit: maxOutputSize}
+	stderr := &limitedBuffer{limit: maxStderrSize}
+	pid := &pidWriter{w: output}
+	session.Stdout = pid
+	session.Stderr = stderr
+	if err := session.Start("echo $$; " + shellCommand(command)); err != nil {
+		return "", &models.CommandError{Command: command.String(), ExitCode: -1, Message: err.Error()}
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Wait()
+	}()
+
+	select {
+	case <-ctx.Done():
+		if pid := pid.PID(); pid != "" {
+			kill(client, pid)
+		}
+		session.Close()
+		<-done
+		return "", contextError(ctx, s.target+": "+command.String(), stderr.String())
+	case err := <-done:
+		if err != nil {
+			exitCode := -1
+			if exitErr, ok := err.(*ssh.ExitError); ok {
+				exitCode = exitErr.ExitStatus()
+			}
+			return output.String(), &models.CommandError{Command: s.target + ": " + command.String(), ExitCode: exitCode, Stderr: stderr.String(), Message: err.Error()}
+		}
+		if output.truncated {
+			return "", &models.CommandError{Command: s.target + ": " + command.String(), Message: fmt.Sprintf("output exceeded %d bytes", maxOutputSize)}
+		}
+		return output.String(), nil
+	}
+}
+
+// kill kills the process group of a remote command. sshd starts each
+// session's shell in a new session, so the PID it reported leads the group
+// of the command and its children.
+func kill(client *ssh.Client, pid string) {
+	session, err := client.NewSession()
+	if err != nil {
+		return
+	}
+	defer session.Close()
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Run("kill -9 -" + pid + " 2>/dev/null || kill -9 " + pid)
+	}()
+	select {
+	case <-done:
+	case <-time.After(killTimeout):
+	}
+}
+
+// pidWriter takes the PID the remote shell prints on its first line of
+// stdout and passes the rest through to w
+type pidWriter struct {
+	mtx  sync.Mutex
+	w    io.Writer
+	line []byte
+	pid  string
+	seen bool
+}
+
+func (p *pidWriter) Write(b []byte) (int, error) {
+	p.mtx.Lock()
+	if !p.seen {
+		i := bytes.IndexByte(b, '\n')
+		if i < 0 {
+			p.line = append(p.line, b...)
+			p.mtx.Unlock()
+			return len(b), nil
+		}
+		// Anything but a number would end up in the kill command line
+		if pid := strings.TrimSpace(string(append(p.line, b[:i]...))); isPID(pid) {
+			p.pid = pid
+		}
+		p.seen, p.line = true, nil
+		p.mtx.Unlock()
+		if _, err := p.w.Write(b[i+1:]); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	p.mtx.Unlock()
+	return p.w.Write(b)
+}
+
+func isPID(s string) bool {
+	n, err := strconv.Atoi(s)
+	return err == nil && n > 1
+}
+
+// PID returns the remote shell's PID, empty until it has been printed
+func (p *pidWriter) PID() string {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return p.pid
+}
+
+// shellCommand quotes a command for the remote POSIX shell, which execs it
+// so the command keeps the shell's PID
+func shellCommand(command Command) string {
+	quoted := make([]string, len(command.Args))
+	for i, arg := range command.Args {
+		quoted[i] = shellQuote(arg)
+	}
+	line := "exec " + strings.Join(quoted, " ")
+	if command.Dir != "" {
+		line = "cd " + shellQuote(command.Dir) + " && " + line
+	}
+	return line
+}
+
+// shellQuote single-quotes s, escaping embedded single quotes
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,47 @@
+package executor
+
+import "testing"
+
+func TestPidWriter(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		writes []string
+		pid    string
+		output string
+	}{
+		{"one write", []string{"4730\n{\"Controllers\": []}\n"}, "4730", "{\"Controllers\": []}\n"},
+		{"split pid", []string{"47", "30", "\nout", "put\n"}, "4730", "output\n"},
+		{"no output", []string{"4730\n"}, "4730", ""},
+		{"not a pid", []string{"-1\noutput\n"}, "", "output\n"},
+		{"still running", []string{"47"}, "", ""},
+	} {
+		output := &limitedBuffer{limit: maxOutputSize}
+		p := &pidWriter{w: output}
+		for _, write := range tc.writes {
+			if n, err := p.Write([]byte(write)); n != len(write) || err != nil {
+				t.Errorf("%s: Write(%q) = %d, %v", tc.name, write, n, err)
+			}
+		}
+		if p.PID() != tc.pid || output.String() != tc.output {
+			t.Errorf("%s: got pid %q, output %q, want %q, %q", tc.name, p.PID(), output, tc.pid, tc.output)
+		}
+	}
+}
+
+func TestShellCommand(t *testing.T) {
+	for _, tc := range []struct {
+		command Command
+		want    string
+	}{
+		{Command{Args: []string{"esxcli", "--formatter=xml", "storage", "core", "device", "list"}},
+			`exec 'esxcli' '--formatter=xml' 'storage' 'core' 'device' 'list'`},
+		{Command{Dir: "/opt/lsi/perccli", Args: []string{"/opt/lsi/perccli/perccli", "/cALL", "show", "all", "J"}},
+			`cd '/opt/lsi/perccli' && exec '/opt/lsi/perccli/perccli' '/cALL' 'show' 'all' 'J'`},
+		{Command{Args: []string{"smartctl", "-a", "/vmfs/devices/disks/t10.ATA_'x'; reboot"}},
+			`exec 'smartctl' '-a' '/vmfs/devices/disks/t10.ATA_'\''x'\''; reboot'`},
+	} {
+		if got := shellCommand(tc.command); got != tc.want {
+			t.Errorf("shellCommand(%q) = %s, want %s", tc.command.Args, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package generate
+
+import (
+	"encoding/json"
+	"esxi_exporter/internal/metrics"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// panelDef describes one generated panel. stat panels show the current
+// value of every series, mapped to the states listed in the metric help;
+// good lists the values shown green. timeseries panels graph the metric.
+type panelDef struct {
+	kind     string
+	title    string
+	metric   string
+	selector string
+	legend   []string
+	unit     string
+	good     []float64
+}
+
+// rowDef groups panels under a collapsible row
+type rowDef struct {
+	title  string
+	panels []panelDef
+}
+
+var rowDefs = []rowDef{
+	{"Controllers", []panelDef{
+		{kind: "stat", title: "Controller status", metric: "controller_status", legend: []string{"controller"}, good: []float64{1}},
+		{kind: "stat", title: "Virtual drives", metric: "virtual_drive_status", legend: []string{"controller", "vd"}, good: []float64{1}},
+		{kind: "stat", title: "Battery backup units", metric: "bbu_health", legend: []string{"controller"}, good: []float64{1}},
+		{kind: "stat", title: "Enclosures", metric: "enclosure_status", legend: []string{"controller", "enclosure"}, good: []float64{1}},
+		{kind: "timeseries", title: "Controller temperature", metric: "controller_temperature", legend: []string{"controller"}, unit: "celsius"},
+	}},
+	{"Drives", []panelDef{
+		{kind: "stat", title: "Drive status", metric: "drive_status", legend: []string{"drive"}, good: []float64{1, 2, 3}},
+		{kind: "stat", title: "Predicted failures", metric: "drive_failure_predicted", legend: []string{"drive"}, good: []float64{0}},
+		{kind: "timeseries", title: "Drive temperature", metric: "drive_temp", legend: []string{"drive"}, unit: "celsius"},
+		{kind: "timeseries", title: "Reallocated sectors", metric: "drive_smart", selector: `attribute="` + metrics.SmartReallocatedSectors + `"`, legend: []string{"drive"}, unit: "none"},
+		{kind: "timeseries", title: "Pending sectors", metric: "drive_smart", selector: `attribute="` + metrics.SmartPendingSectors + `"`, legend: []string{"drive"}, unit: "none"},
+	}},
+	{"Collectors", []panelDef{
+		{kind: "stat", title: "Collector success", metric: "collector_success", legend: []string{"collector"}, good: []float64{1}},
+		{kind: "timeseries", title: "Collector duration", metric: "collector_duration_seconds", legend: []string{"collector"}, unit: "s"},
+	}},
+}
+
+// Grafana dashboard JSON model, limited to what the generated dashboard uses
+type dashboard struct {
+	UID           string     `json:"uid"`
+	Title         string     `json:"title"`
+	Tags          []string   `json:"tags"`
+	SchemaVersion int        `json:"schemaVersion"`
+	Refresh       string     `json:"refresh"`
+	Time          timeRange  `json:"time"`
+	Templating    templating `json:"templating"`
+	Panels        []panel    `json:"panels"`
+}
+
+type timeRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type templating struct {
+	List []variable `json:"list"`
+}
+
+type variable struct {
+	Name       string      `json:"name"`
+	Label      string      `json:"label"`
+	Type       string      `json:"type"`
+	Query      string      `json:"query"`
+	Datasource *datasource `json:"datasource,omitempty"`
+	Refresh    int         `json:"refresh,omitempty"`
+	Multi      bool        `json:"multi,omitempty"`
+	IncludeAll bool        `json:"includeAll,omitempty"`
+}
+
+type datasource struct {
+	Type string `json:"type"`
+	UID  string `json:"uid"`
+}
+
+type gridPos struct {
+	H int `json:"h"`
+	W int `json:"w"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type panel struct {
+	ID          int                    `json:"id"`
+	Type        string                 `json:"type"`
+	Title       string                 `json:"title"`
+	Description string                 `json:"description,omitempty"`
+	GridPos     gridPos                `json:"gridPos"`
+	Datasource  *datasource            `json:"datasource,omitempty"`
+	Targets     []target               `json:"targets,omitempty"`
+	FieldConfig *fieldConfig           `json:"fieldConfig,omitempty"`
+	Options     map[string]interface{} `json:"options,omitempty"`
+	Collapsed   *bool                  `json:"collapsed,omitempty"`
+	Panels      []panel                `json:"panels,omitempty"`
+}
+
+type target struct {
+	RefID        string `json:"refId"`
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat"`
+	Instant      bool   `json:"instant,omitempty"`
+}
+
+type fieldConfig struct {
+	Defaults fieldDefaults `json:"defaults"`
+}
+
+type fieldDefaults struct {
+	Unit     string        `json:"unit,omitempty"`
+	Mappings []interface{} `json:"mappings,omitempty"`
+}
+
+// promDatasource is the datasource picked through the datasource variable
+var promDatasource = &datasource{Type: "prometheus", UID: "${datasource}"}
+
+// Dashboard returns a Grafana dashboard with the storage and collector
+// metrics of the hosts selected through its instance variable
+func Dashboard() ([]byte, error) {
+	defs := definitions()
+	d := dashboard{
+		UID:           "esxi-exporter",
+		Title:         "ESXi storage",
+		Tags:          []string{"esxi", "esxi_exporter"},
+		SchemaVersion: 36,
+		Refresh:       "1m",
+		Time:          timeRange{From: "now-24h", To: "now"},
+		Templating: templating{List: []variable{
+			{Name: "datasource", Label: "Data source", Type: "datasource", Query: "prometheus"},
+			{Name: "instance", Label: "Host", Type: "query", Datasource: promDatasource,
+				Query: "label_values(" + defs["collector_success"].Name + ", instance)", Refresh: 2, Multi: true, IncludeAll: true},
+		}},
+	}
+
+	id, y := 1, 0
+	for _, row := range rowDefs {
+		collapsed := false
+		d.Panels = append(d.Panels, panel{ID: id, Type: "row", Title: row.title, GridPos: gridPos{H: 1, W: 24, Y: y}, Collapsed: &collapsed})
+		id++
+		y++
+
+		for i, p := range row.panels {
+			def, ok := defs[p.metric]
+			if !ok {
+				return nil, fmt.Errorf("panel %q: unknown metric %q", p.title, p.metric)
+			}
+			legend := make([]string, len(p.legend))
+			for j, label := range p.legend {
+				if !hasLabel(def.Labels, label) {
+					return nil, fmt.Errorf("panel %q: metric %s has no label %q", p.title, def.Name, label)
+				}
+				legend[j] = "{{" + label + "}}"
+			}
+
+			selector := `instance=~"$instance"`
+			if p.selector != "" {
+				selector += "," + p.selector
+			}
+			out := panel{
+				ID:          id,
+				Type:        p.kind,
+				Title:       p.title,
+				Description: def.Help,
+				GridPos:     gridPos{H: 8, W: 12, X: 12 * (i % 2), Y: y + 8*(i/2)},
+				Datasource:  promDatasource,
+				Targets: []target{{
+					RefID:        "A",
+					Expr:         def.Name + "{" + selector + "}",
+					LegendFormat: "{{instance}} " + strings.Join(legend, " "),
+					Instant:      p.kind == "stat",
+				}},
+				FieldConfig: &fieldConfig{Defaults: fieldDefaults{Unit: p.unit}},
+			}
+			if p.kind == "stat" {
+				out.FieldConfig.Defaults.Mappings = stateMappings(def.Help, p.good)
+				out.Options = map[string]interface{}{
+					"reduceOptions": map[string]interface{}{"calcs": []string{"lastNotNull"}},
+					"colorMode":     "background",
+					"graphMode":     "none",
+					"textMode":      "value_and_name",
+				}
+			}
+			d.Panels = append(d.Panels, out)
+			id++
+		}
+		y += 8 * ((len(row.panels) + 1) / 2)
+	}
+
+	out, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
+
+// stateRe matches the state list ending a help text, e.g. "(1=Online, 0=Other)"
+var stateRe = regexp.MustCompile(`\(((?:\d+=[^,()]+, )*\d+=[^,()]+)\)$`)
+
+// stateMappings turns the states listed in a help text into Grafana value
+// mappings, coloring the good values green and the others red
+func stateMappings(help string, good []float64) []interface{} {
+	match := stateRe.FindStringSubmatch(help)
+	if match == nil {
+		return nil
+	}
+	options := make(map[string]interface{})
+	for i, state := range strings.Split(match[1], ", ") {
+		parts := strings.SplitN(state, "=", 2)
+		color := "red"
+		for _, value := range good {
+			if parts[0] == fmt.Sprint(value) {
+				color = "green"
+			}
+		}
+		options[parts[0]] = map[string]interface{}{"text": parts[1], "color": color, "index": i}
+	}
+	return []interface{}{map[string]interface{}{"type": "value", "options": options}}
+}
+
+func hasLabel(labels []string, label string) bool {
+	for _, l := range labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
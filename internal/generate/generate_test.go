@@ -0,0 +1,78 @@
+package generate
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "Rewrite the golden files in testdata")
+
+// golden compares got with testdata/name, rewriting the file with -update
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := ioutil.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading golden file (run with -update to create it): %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs from the generated output; run go test ./internal/generate -update and review the diff\ngot:\n%s", path, got)
+	}
+}
+
+func TestRules(t *testing.T) {
+	out, err := Rules(DefaultRuleOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "rules.yml.golden", out)
+}
+
+func TestDashboard(t *testing.T) {
+	out, err := Dashboard()
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "dashboard.json.golden", out)
+}
+
+func TestStateMappings(t *testing.T) {
+	for _, tc := range []struct {
+		help  string
+		good  []float64
+		green []string
+		red   []string
+	}{
+		{"Controller status (1=Optimal, 0=Not Optimal)", []float64{1}, []string{"1"}, []string{"0"}},
+		{"Drive predicts its own failure (1=Predicted, 0=Not predicted)", []float64{0}, []string{"0"}, []string{"1"}},
+		{"Physical drive status (1=Online, 2=Hot spare, 3=Unconfigured good, 0=Other)", []float64{1, 2, 3}, []string{"1", "2", "3"}, []string{"0"}},
+		{"Physical drive temperature in Celsius", []float64{1}, nil, nil},
+	} {
+		mappings := stateMappings(tc.help, tc.good)
+		if len(tc.green) == 0 {
+			if mappings != nil {
+				t.Errorf("stateMappings(%q) = %v, want none", tc.help, mappings)
+			}
+			continue
+		}
+		options := mappings[0].(map[string]interface{})["options"].(map[string]interface{})
+		if len(options) != len(tc.green)+len(tc.red) {
+			t.Errorf("stateMappings(%q) has %d states, want %d", tc.help, len(options), len(tc.green)+len(tc.red))
+		}
+		for color, values := range map[string][]string{"green": tc.green, "red": tc.red} {
+			for _, value := range values {
+				if got := options[value].(map[string]interface{})["color"]; got != color {
+					t.Errorf("stateMappings(%q) colors %s %v, want %s", tc.help, value, got, color)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package generate
+
+import (
+	"esxi_exporter/internal/metrics"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// RuleOptions holds the thresholds of the generated alerting rules
+type RuleOptions struct {
+	DriveTemperature      float64
+	ControllerTemperature float64
+}
+
+// DefaultRuleOptions are the thresholds used unless overridden
+var DefaultRuleOptions = RuleOptions{
+	DriveTemperature:      55,
+	ControllerTemperature: 100,
+}
+
+// alertDef describes one generated alert. expr is a format string with one
+// %s per entry of metrics, replaced by the full metric names; referencing a
+// metric that isn't defined is an error so the rules can't drift from the
+// collectors.
+type alertDef struct {
+	name     string
+	expr     string
+	metrics  []string
+	duration string
+	severity string
+	summary  string
+}
+
+func alertDefs(opts RuleOptions) []alertDef {
+	return []alertDef{
+		{"EsxiControllerNotOptimal", "%s == 0", []string{"controller_status"}, "5m", "critical",
+			"RAID controller {{ $labels.controller }} on {{ $labels.instance }} is not optimal"},
+		{"EsxiVirtualDriveDegraded", "%s == 0", []string{"virtual_drive_status"}, "5m", "critical",
+			"Virtual drive {{ $labels.vd }} on controller {{ $labels.controller }} of {{ $labels.instance }} is not optimal"},
+		{"EsxiDriveFailed", "%s == 0", []string{"drive_status"}, "5m", "critical",
+			"{{ $labels.drive }} on {{ $labels.instance }} is neither online nor a spare"},
+		{"EsxiDrivePredictiveFailure", "%s == 1", []string{"drive_failure_predicted"}, "5m", "warning",
+			"{{ $labels.drive }} on {{ $labels.instance }} predicts its own failure"},
+		{"EsxiDriveReallocatedSectorsGrowing", `delta(%s{attribute="` + metrics.SmartReallocatedSectors + `"}[1d]) > 0`, []string{"drive_smart"}, "", "warning",
+			"{{ $labels.drive }} on {{ $labels.instance }} reallocated {{ $value }} sectors in the last day"},
+		{"EsxiDriveTemperatureHigh", fmt.Sprintf("%%s > %v", opts.DriveTemperature), []string{"drive_temp"}, "15m", "warning",
+			"{{ $labels.drive }} on {{ $labels.instance }} is at {{ $value }} C"},
+		{"EsxiControllerTemperatureHigh", fmt.Sprintf("%%s > %v", opts.ControllerTemperature), []string{"controller_temperature"}, "15m", "warning",
+			"RAID controller {{ $labels.controller }} on {{ $labels.instance }} is at {{ $value }} C"},
+		{"EsxiBBUUnhealthy", "%s == 0", []string{"bbu_health"}, "15m", "warning",
+			"Battery backup unit of controller {{ $labels.controller }} on {{ $labels.instance }} is unhealthy"},
+		{"EsxiCollectorFailing", "%s == 0", []string{"collector_success"}, "30m", "warning",
+			"Collector {{ $labels.collector }} on {{ $labels.instance }} keeps failing"},
+	}
+}
+
+// ruleFile is the Prometheus rules file format
+type ruleFile struct {
+	Groups []ruleGroup `yaml:"groups"`
+}
+
+type ruleGroup struct {
+	Name  string `yaml:"name"`
+	Rules []rule `yaml:"rules"`
+}
+
+type rule struct {
+	Alert       string            `yaml:"alert"`
+	Expr        string            `yaml:"expr"`
+	For         string            `yaml:"for,omitempty"`
+	Labels      map[string]string `yaml:"labels"`
+	Annotations map[string]string `yaml:"annotations"`
+}
+
+// Rules returns a Prometheus alerting rules file covering controllers,
+// virtual and physical drives, BBUs and collectors
+func Rules(opts RuleOptions) ([]byte, error) {
+	defs := definitions()
+	group := ruleGroup{Name: "esxi_exporter"}
+	for _, a := range alertDefs(opts) {
+		args := make([]interface{}, len(a.metrics))
+		help := make([]string, len(a.metrics))
+		for i, name := range a.metrics {
+			def, ok := defs[name]
+			if !ok {
+				return nil, fmt.Errorf("alert %s: unknown metric %q", a.name, name)
+			}
+			args[i] = def.Name
+			help[i] = def.Name + ": " + def.Help
+		}
+		group.Rules = append(group.Rules, rule{
+			Alert:  a.name,
+			Expr:   fmt.Sprintf(a.expr, args...),
+			For:    a.duration,
+			Labels: map[string]string{"severity": a.severity},
+			Annotations: map[string]string{
+				"summary":     a.summary,
+				"description": strings.Join(help, "\n"),
+			},
+		})
+	}
+
+	out, err := yaml.Marshal(ruleFile{Groups: []ruleGroup{group}})
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte("# Generated by esxi_exporter generate rules\n"), out...), nil
+}
+
+// definitions indexes the metric definitions by name without the namespace
+func definitions() map[string]metrics.Definition {
+	defs := make(map[string]metrics.Definition)
+	for _, def := range metrics.Definitions() {
+		defs[strings.TrimPrefix(def.Name, metrics.Namespace+"_")] = def
+	}
+	return defs
+}
@@ -9,3 +9,21 @@ func GetString(m map[string]interface{}, key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// BoolToFloat converts a boolean into a 1/0 gauge value
+func BoolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// FirstNonEmpty returns the first non-empty string of values
+func FirstNonEmpty(values ...string) string {
+	for _, val := range values {
+		if val != "" {
+			return val
+		}
+	}
+	return ""
+}
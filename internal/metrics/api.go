@@ -0,0 +1,293 @@
+package metrics
+
+import (
+	"esxi_exporter/internal/models"
+	"fmt"
+	"sort"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// storageFamilies are read back from the snapshots to build the inventory
+var storageFamilies = []string{
+	"controller_info", "controller_status", "controller_temperature", "bbu_health",
+	"enclosure_info", "enclosure_status", "enclosure_slots", "enclosure_drives",
+	"drive_status", "drive_temp", "drive_failure_predicted", "drive_smart",
+	"virtual_drive_status", "virtual_drive_info",
+}
+
+// inventoryBuilder indexes controllers and their components while reading samples
+type inventoryBuilder struct {
+	controllers map[string]*controllerBuilder
+}
+
+// controllerBuilder indexes the components of a controller by ID. The
+// pointers returned by its methods are only valid until the next call.
+type controllerBuilder struct {
+	models.Controller
+	enclosures    map[string]int
+	drives        map[string]int
+	virtualDrives map[string]int
+}
+
+// Inventory builds the storage inventory from the served snapshots, so it
+// matches what /metrics returns
+func (m *Metrics) Inventory() models.Inventory {
+	inventory := models.Inventory{
+		SchemaVersion: models.SchemaVersion,
+		Host:          m.Host(),
+		Controllers:   []models.Controller{},
+	}
+
+	m.snapshotMtx.RLock()
+	if s, ok := m.snapshots["storage"]; ok {
+		inventory.CollectedAt = s.taken
+	}
+	m.snapshotMtx.RUnlock()
+
+	families, err := snapshotGatherer{m}.Gather()
+	if err != nil && len(families) == 0 {
+		return inventory
+	}
+	byName := make(map[string]*dto.MetricFamily, len(families))
+	for _, family := range families {
+		byName[strings.TrimPrefix(family.GetName(), m.namespace+"_")] = family
+	}
+
+	b := &inventoryBuilder{controllers: make(map[string]*controllerBuilder)}
+	for _, name := range storageFamilies {
+		family, ok := byName[name]
+		if !ok {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			b.add(name, labelMap(metric), metric.GetGauge().GetValue())
+		}
+	}
+	inventory.Controllers = b.build()
+	return inventory
+}
+
+// add records one sample of a storage family
+func (b *inventoryBuilder) add(family string, labels map[string]string, value float64) {
+	source := labels["source"]
+	if source == "" {
+		// The enclosure families are only read through perccli
+		source = "perccli"
+	}
+	controller := b.controller(labels["controller"], source)
+
+	switch family {
+	case "controller_info":
+		controller.Model = labels["model"]
+		controller.Serial = labels["serial"]
+		controller.FirmwareVersion = labels["fwversion"]
+	case "controller_status":
+		controller.State = state(value, models.StateOptimal)
+	case "controller_temperature":
+		controller.TemperatureCelsius = floatPtr(value)
+	case "bbu_health":
+		controller.BBU = &models.BBU{State: state(value, models.StateHealthy)}
+	case "enclosure_info":
+		enclosure := controller.enclosure(labels["enclosure"])
+		enclosure.ProductID = labels["product_id"]
+		enclosure.Vendor = labels["vendor"]
+	case "enclosure_status":
+		controller.enclosure(labels["enclosure"]).State = state(value, models.StateHealthy)
+	case "enclosure_slots":
+		controller.enclosure(labels["enclosure"]).Slots = floatPtr(value)
+	case "enclosure_drives":
+		controller.enclosure(labels["enclosure"]).Drives = floatPtr(value)
+	case "drive_status":
+		drive := controller.drive(labels["drive"])
+		drive.Model = labels["model_name"]
+		drive.Protocol = labels["protocol"]
+		drive.State = driveState(value)
+	case "drive_temp":
+		controller.drive(labels["drive"]).TemperatureCelsius = floatPtr(value)
+	case "drive_failure_predicted":
+		predicted := value == 1
+		controller.drive(labels["drive"]).FailurePredicted = &predicted
+	case "drive_smart":
+		drive := controller.drive(labels["drive"])
+		if drive.Smart == nil {
+			drive.Smart = make(map[string]float64)
+		}
+		drive.Smart[labels["attribute"]] = value
+	case "virtual_drive_status":
+		controller.virtualDrive(labels["vd"]).State = state(value, models.StateOptimal)
+	case "virtual_drive_info":
+		controller.virtualDrive(labels["vd"]).DeviceID = labels["device_id"]
+	}
+}
+
+func (b *inventoryBuilder) controller(id, source string) *controllerBuilder {
+	// Drives found through esxcli are labelled controller="esxcli"
+	key := id + "\xff" + source
+	if c, ok := b.controllers[key]; ok {
+		return c
+	}
+	c := &controllerBuilder{
+		Controller: models.Controller{
+			ID:             id,
+			Source:         source,
+			Enclosures:     []models.Enclosure{},
+			PhysicalDrives: []models.PhysicalDrive{},
+			VirtualDrives:  []models.VirtualDrive{},
+		},
+		enclosures:    make(map[string]int),
+		drives:        make(map[string]int),
+		virtualDrives: make(map[string]int),
+	}
+	b.controllers[key] = c
+	return c
+}
+
+func (c *controllerBuilder) enclosure(id string) *models.Enclosure {
+	i, ok := c.enclosures[id]
+	if !ok {
+		i = len(c.Enclosures)
+		c.enclosures[id] = i
+		c.Enclosures = append(c.Enclosures, models.Enclosure{ID: id})
+	}
+	return &c.Enclosures[i]
+}
+
+func (c *controllerBuilder) drive(id string) *models.PhysicalDrive {
+	i, ok := c.drives[id]
+	if !ok {
+		i = len(c.PhysicalDrives)
+		c.drives[id] = i
+		c.PhysicalDrives = append(c.PhysicalDrives, models.PhysicalDrive{ID: id})
+	}
+	return &c.PhysicalDrives[i]
+}
+
+func (c *controllerBuilder) virtualDrive(id string) *models.VirtualDrive {
+	i, ok := c.virtualDrives[id]
+	if !ok {
+		i = len(c.VirtualDrives)
+		c.virtualDrives[id] = i
+		c.VirtualDrives = append(c.VirtualDrives, models.VirtualDrive{ID: id})
+	}
+	return &c.VirtualDrives[i]
+}
+
+// build returns the controllers and their components sorted by ID
+func (b *inventoryBuilder) build() []models.Controller {
+	controllers := make([]models.Controller, 0, len(b.controllers))
+	for _, c := range b.controllers {
+		sort.Slice(c.Enclosures, func(i, j int) bool { return c.Enclosures[i].ID < c.Enclosures[j].ID })
+		sort.Slice(c.PhysicalDrives, func(i, j int) bool { return c.PhysicalDrives[i].ID < c.PhysicalDrives[j].ID })
+		sort.Slice(c.VirtualDrives, func(i, j int) bool { return c.VirtualDrives[i].ID < c.VirtualDrives[j].ID })
+		controllers = append(controllers, c.Controller)
+	}
+	sort.Slice(controllers, func(i, j int) bool {
+		if controllers[i].ID != controllers[j].ID {
+			return controllers[i].ID < controllers[j].ID
+		}
+		return controllers[i].Source < controllers[j].Source
+	})
+	return controllers
+}
+
+// Health lists the unhealthy controllers, drives, virtual drives and BBUs
+// of the inventory along with failing collectors
+func (m *Metrics) Health() models.Health {
+	inventory := m.Inventory()
+	health := models.Health{
+		SchemaVersion: models.SchemaVersion,
+		Host:          inventory.Host,
+		Problems:      []models.Problem{},
+		Collectors:    []models.CollectorHealth{},
+	}
+
+	for _, c := range inventory.Controllers {
+		if c.State == models.StateOther {
+			health.Problems = append(health.Problems, models.Problem{Severity: models.SeverityCritical, Component: "controller", Controller: c.ID, ID: c.ID, Message: "controller is not optimal"})
+		}
+		if c.BBU != nil && c.BBU.State == models.StateOther {
+			health.Problems = append(health.Problems, models.Problem{Severity: models.SeverityWarning, Component: "bbu", Controller: c.ID, ID: c.ID, Message: "battery backup unit is unhealthy"})
+		}
+		for _, e := range c.Enclosures {
+			if e.State == models.StateOther {
+				health.Problems = append(health.Problems, models.Problem{Severity: models.SeverityWarning, Component: "enclosure", Controller: c.ID, ID: e.ID, Message: "enclosure is not OK"})
+			}
+		}
+		for _, vd := range c.VirtualDrives {
+			if vd.State == models.StateOther {
+				health.Problems = append(health.Problems, models.Problem{Severity: models.SeverityCritical, Component: "virtual_drive", Controller: c.ID, ID: vd.ID, Message: "virtual drive is not optimal"})
+			}
+		}
+		for _, d := range c.PhysicalDrives {
+			if d.State == models.StateOther {
+				health.Problems = append(health.Problems, models.Problem{Severity: models.SeverityCritical, Component: "physical_drive", Controller: c.ID, ID: d.ID, Message: "drive is not online"})
+			}
+			if d.FailurePredicted != nil && *d.FailurePredicted {
+				health.Problems = append(health.Problems, models.Problem{Severity: models.SeverityWarning, Component: "physical_drive", Controller: c.ID, ID: d.ID, Message: "drive predicts its failure"})
+			}
+		}
+	}
+
+	for _, s := range m.Status() {
+		health.Collectors = append(health.Collectors, models.CollectorHealth{
+			Name:            s.Name,
+			LastRun:         s.LastRun,
+			DurationSeconds: s.Duration.Seconds(),
+			Error:           s.Err,
+		})
+		if s.Err != "" {
+			health.Problems = append(health.Problems, models.Problem{Severity: models.SeverityWarning, Component: "collector", ID: s.Name, Message: fmt.Sprintf("collector failed: %s", s.Err)})
+		}
+	}
+
+	health.Status = WorstSeverity(health.Problems)
+	return health
+}
+
+// WorstSeverity returns "ok" or the severity of the worst problem
+func WorstSeverity(problems []models.Problem) string {
+	status := "ok"
+	for _, p := range problems {
+		if p.Severity == models.SeverityCritical {
+			return models.SeverityCritical
+		}
+		status = models.SeverityWarning
+	}
+	return status
+}
+
+// labelMap returns the labels of a sample by name
+func labelMap(metric *dto.Metric) map[string]string {
+	labels := make(map[string]string, len(metric.GetLabel()))
+	for _, pair := range metric.GetLabel() {
+		labels[pair.GetName()] = pair.GetValue()
+	}
+	return labels
+}
+
+// state maps a 1/0 status gauge to the healthy state or "other"
+func state(value float64, healthy string) string {
+	if value == 1 {
+		return healthy
+	}
+	return models.StateOther
+}
+
+// driveState maps a drive_status value to its state
+func driveState(value float64) string {
+	switch value {
+	case driveOnline:
+		return models.StateOnline
+	case driveHotSpare:
+		return models.StateSpare
+	case driveUnconfiguredGood:
+		return models.StateUnconfiguredGood
+	}
+	return models.StateOther
+}
+
+func floatPtr(value float64) *float64 {
+	return &value
+}
@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// counterVec exposes cumulative totals read from the host (NIC statistics
+// and the like) with counter semantics. Unlike prometheus.CounterVec the
+// values are set from the source rather than incremented.
+type counterVec struct {
+	desc   *prometheus.Desc
+	labels []string
+
+	mtx     sync.Mutex
+	samples map[string]counterSample
+}
+
+type counterSample struct {
+	labelValues []string
+	value       float64
+}
+
+func newCounterVec(namespace, name, help string, labels []string) *counterVec {
+	return &counterVec{
+		desc:    prometheus.NewDesc(prometheus.BuildFQName(namespace, "", name), help, labels, nil),
+		labels:  labels,
+		samples: make(map[string]counterSample),
+	}
+}
+
+// Set records the current total for the given labels
+func (c *counterVec) Set(labels prometheus.Labels, value float64) {
+	labelValues := make([]string, len(c.labels))
+	for i, name := range c.labels {
+		labelValues[i] = labels[name]
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.samples[key] = counterSample{labelValues: labelValues, value: value}
+}
+
+// Describe implements prometheus.Collector
+func (c *counterVec) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// Collect implements prometheus.Collector
+func (c *counterVec) Collect(ch chan<- prometheus.Metric) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	for _, sample := range c.samples {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.CounterValue, sample.value, sample.labelValues...)
+	}
+}
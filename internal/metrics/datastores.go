@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"esxi_exporter/internal/helpers"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// datastoreType normalises the esxcli filesystem type (VMFS-6, NFS41, vsan, ...)
+func datastoreType(fsType string) string {
+	upper := strings.ToUpper(fsType)
+	switch {
+	case strings.HasPrefix(upper, "VMFS"):
+		return "VMFS"
+	case strings.HasPrefix(upper, "NFS"):
+		return "NFS"
+	case strings.HasPrefix(upper, "VSAN"):
+		return "vSAN"
+	case upper == "":
+		return "Unknown"
+	}
+	return fsType
+}
+
+// collectDatastores exports datastore capacity and state along with their
+// backing devices. Extents are listed even when the filesystems can't be;
+// both errors are returned together.
+func (m *Metrics) collectDatastores() error {
+	var errs []error
+	filesystems, err := m.runEsxcli("storage", "filesystem", "list")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	for _, fs := range filesystems {
+		uuid := fs.Get("UUID", "")
+		name := fs.Get("VolumeName", uuid)
+		if name == "" {
+			continue
+		}
+		// vfat scratch and bootbank partitions are not datastores
+		if strings.EqualFold(fs.Get("Type", ""), "vfat") {
+			continue
+		}
+
+		m.metrics["datastore_info"].With(prometheus.Labels{
+			"datastore":   name,
+			"uuid":        uuid,
+			"type":        datastoreType(fs.Get("Type", "")),
+			"fs_type":     fs.Get("Type", "Unknown"),
+			"mount_point": fs.Get("MountPoint", ""),
+		}).Set(1)
+
+		labels := prometheus.Labels{"datastore": name}
+		if size, ok := fs.Float("Size"); ok {
+			m.metrics["datastore_capacity_bytes"].With(labels).Set(size)
+		}
+		if free, ok := fs.Float("Free"); ok {
+			m.metrics["datastore_free_bytes"].With(labels).Set(free)
+		}
+
+		mounted := fs.Bool("Mounted")
+		accessible := mounted && fs.Get("MountPoint", "") != ""
+		if _, ok := fs["Accessible"]; ok {
+			accessible = fs.Bool("Accessible")
+		}
+		m.metrics["datastore_mounted"].With(labels).Set(helpers.BoolToFloat(mounted))
+		m.metrics["datastore_accessible"].With(labels).Set(helpers.BoolToFloat(accessible))
+	}
+
+	extents, err := m.runEsxcli("storage", "vmfs", "extent", "list")
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for _, extent := range extents {
+		name := extent.Get("VolumeName", extent.Get("VMFSUUID", ""))
+		deviceID := extent.Get("DeviceName", "")
+		if name == "" || deviceID == "" {
+			continue
+		}
+		m.metrics["datastore_extent_info"].With(prometheus.Labels{
+			"datastore": name,
+			"device_id": deviceID,
+			"partition": extent.Get("Partition", ""),
+			"extent":    extent.Get("ExtentNumber", "0"),
+		}).Set(1)
+	}
+
+	return joinErrors(errs)
+}
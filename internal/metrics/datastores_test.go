@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCollectDatastoresWithoutFilesystems(t *testing.T) {
+	run, build := newTestRun(t, esxcliExecutor{
+		"storage vmfs extent list": `[
+			{"VolumeName": "datastore1", "VMFSUUID": "5f9a1c2e-8c1b2a3d", "DeviceName": "naa.600508b1001c4d41", "Partition": "3", "ExtentNumber": "0"}
+		]`,
+	}, "datastores")
+
+	err := run.collectDatastores()
+	if err == nil || !strings.Contains(err.Error(), "storage filesystem list") {
+		t.Errorf("got error %v, want the filesystem list failure", err)
+	}
+	want := "datastore=datastore1,device_id=naa.600508b1001c4d41,extent=0,partition=3"
+	if got := gauges(t, build, "datastore_extent_info"); got[want] != 1 || len(got) != 1 {
+		t.Errorf("got datastore_extent_info %v, want %s", got, want)
+	}
+}
+
+func TestCollectDatastoresCombinesErrors(t *testing.T) {
+	run, _ := newTestRun(t, esxcliExecutor{}, "datastores")
+	err := run.collectDatastores()
+	if err == nil {
+		t.Fatal("got no error")
+	}
+	for _, command := range []string{"storage filesystem list", "storage vmfs extent list"} {
+		if !strings.Contains(err.Error(), command) {
+			t.Errorf("error %q doesn't mention %s", err, command)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"encoding/json"
+	"esxi_exporter/internal/helpers"
+	"fmt"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// collectEnclosures exports the enclosures (backplanes) attached to PERC controllers
+func (m *Metrics) collectEnclosures() error {
+	stdout, err := m.runPerccli("/cALL/eALL", "show", "J")
+	if err != nil {
+		return err
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(stdout), &data); err != nil {
+		return fmt.Errorf("failed to decode JSON from perccli output: %v", err)
+	}
+	controllers, ok := data["Controllers"].([]interface{})
+	if !ok {
+		return fmt.Errorf("perccli returned no controller data")
+	}
+
+	for _, controller := range controllers {
+		controllerMap, ok := controller.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		commandStatus, _ := controllerMap["Command Status"].(map[string]interface{})
+		controllerIndex := fmt.Sprint(commandStatus["Controller"])
+		response, ok := controllerMap["Response Data"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		properties, _ := response["Properties"].([]interface{})
+		for _, enclosure := range properties {
+			enclosureMap, ok := enclosure.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			enclosureID := fmt.Sprint(enclosureMap["EID"])
+			m.metrics["enclosure_info"].With(prometheus.Labels{
+				"controller": controllerIndex,
+				"enclosure":  enclosureID,
+				"product_id": helpers.GetString(enclosureMap, "ProdID", "Unknown"),
+				"vendor":     helpers.GetString(enclosureMap, "VendorSpecific", "Unknown"),
+			}).Set(1)
+			m.metrics["enclosure_status"].With(prometheus.Labels{
+				"controller": controllerIndex,
+				"enclosure":  enclosureID,
+			}).Set(helpers.BoolToFloat(helpers.GetString(enclosureMap, "State", "") == "OK"))
+
+			for key, name := range map[string]string{"Slots": "enclosure_slots", "PD": "enclosure_drives"} {
+				if value, err := strconv.ParseFloat(fmt.Sprint(enclosureMap[key]), 64); err == nil {
+					m.metrics[name].With(prometheus.Labels{
+						"controller": controllerIndex,
+						"enclosure":  enclosureID,
+					}).Set(value)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"errors"
+	"esxi_exporter/internal/esxcli"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// displayNameSuffix matches the " (naa.xxx)" suffix esxcli appends to display names
+var displayNameSuffix = regexp.MustCompile(`\s*\([^)]+\)$`)
+
+// runEsxcli runs an esxcli namespace command with the xml formatter and decodes its output
+func (m *Metrics) runEsxcli(args ...string) ([]esxcli.Record, error) {
+	output, err := m.runCmd("", append([]string{"esxcli", "--formatter=xml"}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	return esxcli.Decode([]byte(output))
+}
+
+// joinErrors combines the errors of the calls that failed during a
+// collection, letting a collector export what the other calls returned.
+// It returns nil when none failed.
+func joinErrors(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+	return errors.New(strings.Join(messages, "; "))
+}
+
+// collectStorageDevices exports every device from esxcli storage core device list
+func (m *Metrics) collectStorageDevices() ([]esxcli.Record, error) {
+	devices, err := m.runEsxcli("storage", "core", "device", "list")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, device := range devices {
+		deviceID := device.Get("Device", "")
+		if deviceID == "" {
+			continue
+		}
+
+		m.metrics["storage_device_info"].With(prometheus.Labels{
+			"device_id":        deviceID,
+			"display_name":     displayNameSuffix.ReplaceAllString(device.Get("DisplayName", ""), ""),
+			"vendor":           device.Get("Vendor", "Unknown"),
+			"model":            device.Get("Model", "Unknown"),
+			"revision":         device.Get("Revision", "Unknown"),
+			"device_type":      device.Get("DeviceType", "Unknown"),
+			"status":           device.Get("Status", "Unknown"),
+			"multipath_plugin": device.Get("MultipathPlugin", "Unknown"),
+			"is_local":         strconv.FormatBool(device.Bool("IsLocal")),
+			"is_offline":       strconv.FormatBool(device.Bool("IsOffline")),
+			"is_ssd":           strconv.FormatBool(device.Bool("IsSSD")),
+		}).Set(1)
+
+		// esxcli reports the device size in MiB
+		if size, ok := device.Float("Size"); ok {
+			m.metrics["storage_device_size_bytes"].With(prometheus.Labels{"device_id": deviceID}).Set(size * 1024 * 1024)
+		}
+		if depth, ok := device.Float("DeviceMaxQueueDepth"); ok {
+			m.metrics["storage_device_queue_depth"].With(prometheus.Labels{"device_id": deviceID}).Set(depth)
+		}
+	}
+
+	return devices, nil
+}
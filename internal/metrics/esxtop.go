@@ -0,0 +1,131 @@
+package metrics
+
+import (
+	"encoding/csv"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// esxtopCounter maps an esxtop batch mode column to a gauge
+type esxtopCounter struct {
+	group   string  // esxtop object without its instance, e.g. "Physical Cpu"
+	counter string  // esxtop counter name, e.g. "% Util Time"
+	metric  string  // gauge in metricDefs
+	label   string  // label receiving the object instance, empty for singletons
+	scale   float64 // factor converting the esxtop unit to the exported one
+}
+
+// esxtopCounters lists the exported esxtop counters keyed by their
+// allow-list name, as listed in config.EsxtopCounters
+var esxtopCounters = map[string]esxtopCounter{
+	"cpu_util":        {"Physical Cpu", "% Util Time", "esxtop_cpu_util_percent", "cpu", 1},
+	"memory_free":     {"Memory", "Free MBytes", "esxtop_memory_free_bytes", "", 1024 * 1024},
+	"memory_active":   {"Memory", "Active MBytes", "esxtop_memory_active_bytes", "", 1024 * 1024},
+	"device_davg":     {"Physical Disk SCSI Device", "Average Driver MilliSec/Command", "esxtop_device_davg_seconds", "device_id", 0.001},
+	"device_kavg":     {"Physical Disk SCSI Device", "Average Kernel MilliSec/Command", "esxtop_device_kavg_seconds", "device_id", 0.001},
+	"device_gavg":     {"Physical Disk SCSI Device", "Average Guest MilliSec/Command", "esxtop_device_gavg_seconds", "device_id", 0.001},
+	"device_qavg":     {"Physical Disk SCSI Device", "Average Queue MilliSec/Command", "esxtop_device_qavg_seconds", "device_id", 0.001},
+	"device_active":   {"Physical Disk SCSI Device", "Active Commands", "esxtop_device_active_commands", "device_id", 1},
+	"device_queued":   {"Physical Disk SCSI Device", "Queued Commands", "esxtop_device_queued_commands", "device_id", 1},
+	"device_commands": {"Physical Disk SCSI Device", "Commands/sec", "esxtop_device_commands_per_second", "device_id", 1},
+	"device_reads":    {"Physical Disk SCSI Device", "Reads/sec", "esxtop_device_reads_per_second", "device_id", 1},
+	"device_writes":   {"Physical Disk SCSI Device", "Writes/sec", "esxtop_device_writes_per_second", "device_id", 1},
+}
+
+// esxtopObject splits "Physical Cpu(_Total)" into group and instance
+var esxtopObject = regexp.MustCompile(`^(.*?)\((.*)\)$`)
+
+// esxtopColumn is a parsed batch mode header such as \\host\Physical Cpu(0)\% Util Time
+type esxtopColumn struct {
+	group    string
+	instance string
+	counter  string
+}
+
+func parseEsxtopHeader(header string) (esxtopColumn, bool) {
+	parts := strings.SplitN(strings.TrimPrefix(header, `\\`), `\`, 3)
+	if len(parts) != 3 {
+		return esxtopColumn{}, false
+	}
+	column := esxtopColumn{group: parts[1], counter: parts[2]}
+	if match := esxtopObject.FindStringSubmatch(parts[1]); match != nil {
+		column.group, column.instance = match[1], match[2]
+	}
+	return column, true
+}
+
+// enabledEsxtopCounters returns the counters selected by the configured allow-list
+func (m *Metrics) enabledEsxtopCounters() ([]esxtopCounter, error) {
+	if len(m.config.Esxtop.Counters) == 0 {
+		counters := make([]esxtopCounter, 0, len(esxtopCounters))
+		for _, counter := range esxtopCounters {
+			counters = append(counters, counter)
+		}
+		return counters, nil
+	}
+
+	counters := make([]esxtopCounter, 0, len(m.config.Esxtop.Counters))
+	for _, name := range m.config.Esxtop.Counters {
+		counter, ok := esxtopCounters[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown esxtop counter %q", name)
+		}
+		counters = append(counters, counter)
+	}
+	return counters, nil
+}
+
+// collectEsxtop exports the allow-listed counters from one esxtop batch mode sample
+func (m *Metrics) collectEsxtop() error {
+	counters, err := m.enabledEsxtopCounters()
+	if err != nil {
+		return err
+	}
+
+	output, err := m.runCmd("", "esxtop", "-b", "-n", "1")
+	if err != nil {
+		return err
+	}
+
+	reader := csv.NewReader(strings.NewReader(output))
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return fmt.Errorf("parsing esxtop output: %v", err)
+	}
+	if len(rows) < 2 {
+		return fmt.Errorf("esxtop returned no samples")
+	}
+	headers, values := rows[0], rows[len(rows)-1]
+
+	for i, header := range headers {
+		if i >= len(values) {
+			break
+		}
+		column, ok := parseEsxtopHeader(header)
+		if !ok {
+			continue
+		}
+		for _, counter := range counters {
+			if counter.group != column.group || counter.counter != column.counter {
+				continue
+			}
+			value, err := strconv.ParseFloat(strings.TrimSpace(values[i]), 64)
+			if err != nil {
+				break
+			}
+			labels := prometheus.Labels{}
+			if counter.label != "" {
+				labels[counter.label] = column.instance
+			}
+			m.metrics[counter.metric].With(labels).Set(value * counter.scale)
+			break
+		}
+	}
+
+	return nil
+}
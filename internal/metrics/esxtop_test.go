@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"context"
+	"esxi_exporter/internal/config"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// The config file is validated against config.EsxtopCounters, so every
+// name there needs a counter here and vice versa
+func TestEsxtopCountersMatchConfig(t *testing.T) {
+	for _, name := range config.EsxtopCounters {
+		if _, ok := esxtopCounters[name]; !ok {
+			t.Errorf("config accepts esxtop counter %q the collector doesn't know", name)
+		}
+	}
+	if len(esxtopCounters) != len(config.EsxtopCounters) {
+		t.Errorf("collector knows %d esxtop counters, config accepts %d", len(esxtopCounters), len(config.EsxtopCounters))
+	}
+}
+
+func TestCollectEsxtop(t *testing.T) {
+	output, err := ioutil.ReadFile(filepath.Join("testdata", "esxtop_batch.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	run, build := newTestRun(t, esxcliExecutor{"esxtop -b -n 1": string(output)}, "esxtop")
+	if err := run.collectEsxtop(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The sample has no Active MBytes column, no value for Queued Commands
+	// and a quoted device name holding a comma. Adapter columns share the
+	// Reads/sec counter name but not the object.
+	for family, want := range map[string]map[string]float64{
+		"esxtop_memory_free_bytes":   {"": 201856 * 1024 * 1024},
+		"esxtop_memory_active_bytes": {},
+		"esxtop_cpu_util_percent": {
+			"cpu=0":      12.5,
+			"cpu=_Total": 8.25,
+		},
+		"esxtop_device_davg_seconds": {"device_id=naa.600508b1001c4d41": 0.002},
+		"esxtop_device_reads_per_second": {
+			"device_id=naa.600508b1001c4d41":          120,
+			"device_id=t10.ATA_____MZ7LH480, rev 104": 35,
+		},
+		"esxtop_device_queued_commands": {},
+	} {
+		if got := gauges(t, build, family); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, want %v", family, got, want)
+		}
+	}
+}
+
+func TestCollectEsxtopAllowList(t *testing.T) {
+	output, err := ioutil.ReadFile(filepath.Join("testdata", "esxtop_batch.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Default()
+	cfg.Esxtop.Counters = []string{"memory_free"}
+	pm, err := NewMetrics(cfg, esxcliExecutor{"esxtop -b -n 1": string(output)}, []string{"esxtop"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	run, build := pm.newRun(context.Background())
+	if err := run.collectEsxtop(); err != nil {
+		t.Fatal(err)
+	}
+	counts := samples(t, build)
+	if counts["esxtop_memory_free_bytes"] != 1 || counts["esxtop_cpu_util_percent"] != 0 {
+		t.Errorf("got %v, want only esxtop_memory_free_bytes", counts)
+	}
+}
+
+func TestCollectEsxtopMalformed(t *testing.T) {
+	for _, output := range []string{
+		"",
+		// a header without samples
+		`"(PDH-CSV 4.0) (UTC)(0)","\\esx01\Memory\Free MBytes"`,
+		// a sample cut off inside a quoted field
+		`"(PDH-CSV 4.0) (UTC)(0)","\\esx01\Memory\Free MBytes"
+"10/18/2026 09:12:44","2018`,
+	} {
+		run, _ := newTestRun(t, esxcliExecutor{"esxtop -b -n 1": output}, "esxtop")
+		if err := run.collectEsxtop(); err == nil {
+			t.Errorf("collectEsxtop(%q) returned no error", output)
+		}
+	}
+}
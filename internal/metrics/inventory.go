@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"esxi_exporter/internal/esxcli"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// getEsxcliRecord runs an esxcli get command and returns its single structure
+func (m *Metrics) getEsxcliRecord(args ...string) (esxcli.Record, error) {
+	records, err := m.runEsxcli(args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return esxcli.Record{}, nil
+	}
+	return records[0], nil
+}
+
+// collectInventory exports host version and platform details and updates
+// the host label. Fields of a failed esxcli call are exported as Unknown and
+// the errors returned together.
+func (m *Metrics) collectInventory() error {
+	var errs []error
+	hostname, err := m.getEsxcliRecord("system", "hostname", "get")
+	if err != nil {
+		errs = append(errs, err)
+	}
+	version, err := m.getEsxcliRecord("system", "version", "get")
+	if err != nil {
+		errs = append(errs, err)
+	}
+	platform, err := m.getEsxcliRecord("hardware", "platform", "get")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	fqdn := hostname.First(m.host, "FullyQualifiedDomainName", "HostName")
+	m.host = fqdn
+
+	m.metrics["host_info"].With(prometheus.Labels{
+		"hostname": fqdn,
+		"version":  version.Get("Version", "Unknown"),
+		"build":    version.Get("Build", "Unknown"),
+		"vendor":   platform.Get("VendorName", "Unknown"),
+		"model":    platform.Get("ProductName", "Unknown"),
+		"serial":   platform.First("Unknown", "SerialNumber", "EnclosureSerialNumber"),
+	}).Set(1)
+
+	return joinErrors(errs)
+}
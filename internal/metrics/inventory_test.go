@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCollectInventoryWithoutPlatform(t *testing.T) {
+	run, build := newTestRun(t, esxcliExecutor{
+		"system hostname get": `{"HostName": "esx01", "DomainName": "example.com", "FullyQualifiedDomainName": "esx01.example.com"}`,
+		"system version get":  `{"Product": "VMware ESXi", "Version": "7.0.3", "Build": "Releasebuild-21686933"}`,
+	}, "inventory")
+
+	err := run.collectInventory()
+	if err == nil || !strings.Contains(err.Error(), "hardware platform get") {
+		t.Errorf("got error %v, want the hardware platform failure", err)
+	}
+	if run.host != "esx01.example.com" {
+		t.Errorf("got host %q, want esx01.example.com", run.host)
+	}
+
+	families, err := build.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var labels map[string]string
+	for _, family := range families {
+		if family.GetName() == Namespace+"_host_info" && len(family.GetMetric()) == 1 {
+			labels = labelMap(family.GetMetric()[0])
+		}
+	}
+	want := map[string]string{
+		"hostname": "esx01.example.com",
+		"version":  "7.0.3",
+		"build":    "Releasebuild-21686933",
+		"vendor":   "Unknown",
+		"model":    "Unknown",
+		"serial":   "Unknown",
+	}
+	for name, value := range want {
+		if labels[name] != value {
+			t.Errorf("got host_info %s=%q, want %q", name, labels[name], value)
+		}
+	}
+}
+
+func TestCollectInventoryCombinesErrors(t *testing.T) {
+	run, _ := newTestRun(t, esxcliExecutor{}, "inventory")
+	host := run.host
+
+	err := run.collectInventory()
+	if err == nil {
+		t.Fatal("got no error")
+	}
+	for _, command := range []string{"system hostname get", "system version get", "hardware platform get"} {
+		if !strings.Contains(err.Error(), command) {
+			t.Errorf("error %q doesn't mention %s", err, command)
+		}
+	}
+	if run.host != host {
+		t.Errorf("got host %q, want %q kept", run.host, host)
+	}
+}
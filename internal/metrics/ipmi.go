@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"esxi_exporter/internal/helpers"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// sensorReading splits a formatted reading such as "3360 RPM" into value and unit
+var sensorReading = regexp.MustCompile(`^\s*(-?[0-9]+(?:\.[0-9]+)?)\s*(.*)$`)
+
+// collectIpmi exports IPMI SDR sensor readings and the SEL entry count. The
+// SEL is read even when the SDR can't be; both errors are returned together.
+func (m *Metrics) collectIpmi() error {
+	var errs []error
+	sensors, err := m.runEsxcli("hardware", "ipmi", "sdr", "list")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	for _, sensor := range sensors {
+		name := sensor.First("", "Description", "Name", "SensorName")
+		if name == "" {
+			continue
+		}
+		id := sensor.First(name, "SensorNum", "SensorNumber", "Id", "ID")
+		sensorType := sensor.First("Unknown", "SensorType", "Type")
+
+		formatted := sensor.First("", "FormattedReading", "Reading")
+		unit := sensor.First("", "Units", "BaseUnit", "Unit")
+		if match := sensorReading.FindStringSubmatch(formatted); match != nil {
+			if value, err := strconv.ParseFloat(match[1], 64); err == nil {
+				if unit == "" {
+					unit = strings.TrimSpace(match[2])
+				}
+				m.metrics["ipmi_sensor_reading"].With(prometheus.Labels{
+					"id":     id,
+					"sensor": name,
+					"type":   sensorType,
+					"unit":   unit,
+				}).Set(value)
+			}
+		}
+
+		status := strings.ToLower(sensor.First("unknown", "Status", "Health", "HealthState"))
+		healthy := status == "normal" || status == "green" || status == "ok"
+		m.metrics["ipmi_sensor_health"].With(prometheus.Labels{
+			"id":     id,
+			"sensor": name,
+			"type":   sensorType,
+		}).Set(helpers.BoolToFloat(healthy))
+	}
+
+	entries, err := m.runEsxcli("hardware", "ipmi", "sel", "list")
+	if err != nil {
+		errs = append(errs, err)
+	} else {
+		m.metrics["ipmi_sel_entries"].With(prometheus.Labels{}).Set(float64(len(entries)))
+	}
+
+	return joinErrors(errs)
+}
@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCollectIpmiWithoutSdr(t *testing.T) {
+	run, build := newTestRun(t, esxcliExecutor{
+		"hardware ipmi sel list": `[
+			{"RecordNumber": "1", "Message": "Log area reset/cleared"},
+			{"RecordNumber": "2", "Message": "Power Supply 2 AC lost"}
+		]`,
+	}, "ipmi")
+
+	err := run.collectIpmi()
+	if err == nil || !strings.Contains(err.Error(), "hardware ipmi sdr list") {
+		t.Errorf("got error %v, want the sdr list failure", err)
+	}
+	if got := gauges(t, build, "ipmi_sel_entries"); got[""] != 2 {
+		t.Errorf("got ipmi_sel_entries %v, want 2", got)
+	}
+}
+
+func TestCollectIpmiCombinesErrors(t *testing.T) {
+	run, _ := newTestRun(t, esxcliExecutor{}, "ipmi")
+	err := run.collectIpmi()
+	if err == nil {
+		t.Fatal("got no error")
+	}
+	for _, command := range []string{"hardware ipmi sdr list", "hardware ipmi sel list"} {
+		if !strings.Contains(err.Error(), command) {
+			t.Errorf("error %q doesn't mention %s", err, command)
+		}
+	}
+}
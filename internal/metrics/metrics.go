@@ -1,123 +1,337 @@
 package metrics
 
 import (
+	"context"
 	"encoding/json"
+	"esxi_exporter/internal/config"
+	"esxi_exporter/internal/esxcli"
+	"esxi_exporter/internal/executor"
 	"esxi_exporter/internal/helpers"
 	"esxi_exporter/internal/models"
+	"esxi_exporter/internal/redfish"
+	"esxi_exporter/internal/vcenter"
+	"esxi_exporter/internal/wbem"
+	"fmt"
 	"log"
-	"os/exec"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+// Install directories of the vendor tools, which run from there
+const (
+	perccliDir  = "/opt/lsi/perccli"
+	smartctlDir = "/opt/smartmontools"
+)
+
+// Namespace prefixes every metric name
+const Namespace = "esxi"
+
+// metricDef describes a gauge exported under the esxi namespace
+type metricDef struct {
+	name   string
+	help   string
+	labels []string
+}
+
+// metricDefs lists every gauge registered by NewMetrics
+var metricDefs = []metricDef{
+	{"collector_success", "Whether the collector's last run succeeded (1=Success, 0=Failure)", []string{"collector"}},
+	{"collector_duration_seconds", "Duration of the collector's last run in seconds", []string{"collector"}},
+
+	{"controller_info", "MegaRAID controller info", []string{"controller", "model", "serial", "fwversion", "source"}},
+	{"controller_status", "Controller status (1=Optimal, 0=Not Optimal)", []string{"controller", "source"}},
+	{"controller_temperature", "Controller temperature in Celsius", []string{"controller", "source"}},
+	{"drive_status", "Physical drive status (1=Online, 2=Hot spare, 3=Unconfigured good, 0=Other)", []string{"controller", "drive", "model_name", "protocol", "source"}},
+	{"drive_temp", "Physical drive temperature in Celsius", []string{"controller", "drive", "source"}},
+	{"drive_smart", "Drive SMART attributes", []string{"controller", "drive", "attribute", "source"}},
+	{"drive_failure_predicted", "Drive predicts its own failure (1=Predicted, 0=Not predicted)", []string{"controller", "drive", "source"}},
+	{"virtual_drive_status", "Virtual drive status (1=Optimal, 0=Other)", []string{"controller", "vd", "source"}},
+	{"virtual_drive_info", "ESXi device backing a virtual drive (always 1)", []string{"controller", "vd", "device_id", "source"}},
+	{"bbu_health", "Battery Backup Unit health (1=Healthy, 0=Unhealthy)", []string{"controller", "source"}},
+	{"smartctl_info", "Indicates smartctl is used for metrics collection (1=Active)", []string{"host"}},
+	{"smartctl_drive", "Lists drives detected via smartctl on ESXi host", []string{"host", "drive", "device_id", "model_name", "protocol"}},
+
+	// perccli /cALL/eALL show
+	{"enclosure_info", "Enclosure attached to a controller (always 1)", []string{"controller", "enclosure", "product_id", "vendor"}},
+	{"enclosure_status", "Enclosure status (1=OK, 0=Other)", []string{"controller", "enclosure"}},
+	{"enclosure_slots", "Number of drive slots of the enclosure", []string{"controller", "enclosure"}},
+	{"enclosure_drives", "Number of physical drives in the enclosure", []string{"controller", "enclosure"}},
+
+	// esxcli system hostname get, system version get and hardware platform get
+	{"host_info", "ESXi host version and hardware platform (always 1)", []string{"hostname", "version", "build", "vendor", "model", "serial"}},
+
+	// esxcli storage core device list
+	{"storage_device_info", "Storage device reported by esxcli (always 1)", []string{"device_id", "display_name", "vendor", "model", "revision", "device_type", "status", "multipath_plugin", "is_local", "is_offline", "is_ssd"}},
+	{"storage_device_size_bytes", "Storage device capacity in bytes", []string{"device_id"}},
+	{"storage_device_queue_depth", "Storage device maximum queue depth", []string{"device_id"}},
+
+	// esxcli storage core path list, storage nmp device list and storage core adapter list
+	{"storage_device_paths", "Number of paths to a storage device by path state", []string{"device_id", "state"}},
+	{"storage_device_multipath_info", "NMP path selection policy of a storage device (always 1)", []string{"device_id", "path_policy", "storage_array_type"}},
+	{"storage_adapter_info", "Storage adapter reported by esxcli (always 1)", []string{"adapter", "driver", "link_state", "description"}},
+	{"storage_adapter_link_up", "Storage adapter link state (1=Up, 0=Down)", []string{"adapter"}},
+
+	// esxcli storage filesystem list and storage vmfs extent list
+	{"datastore_info", "Datastore mounted on the host (always 1)", []string{"datastore", "uuid", "type", "fs_type", "mount_point"}},
+	{"datastore_capacity_bytes", "Datastore capacity in bytes", []string{"datastore"}},
+	{"datastore_free_bytes", "Datastore free space in bytes", []string{"datastore"}},
+	{"datastore_mounted", "Datastore mount state (1=Mounted, 0=Unmounted)", []string{"datastore"}},
+	{"datastore_accessible", "Datastore accessibility (1=Accessible, 0=Inaccessible)", []string{"datastore"}},
+	{"datastore_extent_info", "Device backing a VMFS datastore extent (always 1)", []string{"datastore", "device_id", "partition", "extent"}},
+
+	// esxcli hardware ipmi sdr list and hardware ipmi sel list
+	{"ipmi_sensor_reading", "IPMI sensor reading in the unit reported by the BMC", []string{"id", "sensor", "type", "unit"}},
+	{"ipmi_sensor_health", "IPMI sensor health (1=Normal, 0=Other)", []string{"id", "sensor", "type"}},
+	{"ipmi_sel_entries", "Number of entries in the IPMI system event log", []string{}},
+
+	// esxcli network nic list and network nic get
+	{"nic_info", "Physical NIC driver and firmware (always 1)", []string{"nic", "driver", "driver_version", "firmware_version", "mac", "pci_device"}},
+	{"nic_link_up", "Physical NIC link state (1=Up, 0=Down)", []string{"nic"}},
+	{"nic_admin_up", "Physical NIC administrative state (1=Up, 0=Down)", []string{"nic"}},
+	{"nic_full_duplex", "Physical NIC duplex (1=Full, 0=Half)", []string{"nic"}},
+	{"nic_speed_bytes", "Physical NIC negotiated speed in bytes per second", []string{"nic"}},
+	{"nic_mtu_bytes", "Physical NIC MTU in bytes", []string{"nic"}},
+
+	// esxcli vsan storage list, vsan debug disk list and vsan health cluster list
+	{"vsan_disk_info", "Disk claimed by vSAN with its disk group and role (always 1)", []string{"device_id", "drive", "vsan_uuid", "disk_group_uuid", "role"}},
+	{"vsan_disk_in_cmmds", "vSAN disk is published in CMMDS (1=Yes, 0=No)", []string{"device_id"}},
+	{"vsan_disk_health", "vSAN disk health by check (1=Green, 0=Other)", []string{"device_id", "check"}},
+	{"vsan_disk_congestion", "vSAN disk congestion value (0-255)", []string{"device_id"}},
+	{"vsan_disk_capacity_bytes", "vSAN disk capacity in bytes", []string{"device_id"}},
+	{"vsan_disk_used_bytes", "vSAN disk used capacity in bytes", []string{"device_id"}},
+	{"vsan_health_check", "vSAN cluster health check status (1=Green, 0=Other)", []string{"check"}},
+
+	// vim-cmd vmsvc/getallvms and vmsvc/power.getstate
+	{"vm_info", "Virtual machine registered on the host (always 1)", []string{"vmid", "name", "datastore", "guest_os", "hw_version"}},
+	{"vm_powered_on", "Virtual machine power state (1=Powered on, 0=Other)", []string{"vmid"}},
+
+	// esxtop -b -n 1
+	{"esxtop_cpu_util_percent", "Physical CPU utilisation in percent", []string{"cpu"}},
+	{"esxtop_memory_free_bytes", "Free host machine memory in bytes", []string{}},
+	{"esxtop_memory_active_bytes", "Active host machine memory in bytes", []string{}},
+	{"esxtop_device_davg_seconds", "Average device latency per command (DAVG)", []string{"device_id"}},
+	{"esxtop_device_kavg_seconds", "Average VMkernel latency per command (KAVG)", []string{"device_id"}},
+	{"esxtop_device_gavg_seconds", "Average guest latency per command (GAVG)", []string{"device_id"}},
+	{"esxtop_device_qavg_seconds", "Average queue latency per command (QAVG)", []string{"device_id"}},
+	{"esxtop_device_active_commands", "Commands active on the device", []string{"device_id"}},
+	{"esxtop_device_queued_commands", "Commands queued in the VMkernel for the device", []string{"device_id"}},
+	{"esxtop_device_commands_per_second", "Commands issued to the device per second", []string{"device_id"}},
+	{"esxtop_device_reads_per_second", "Read commands issued to the device per second", []string{"device_id"}},
+	{"esxtop_device_writes_per_second", "Write commands issued to the device per second", []string{"device_id"}},
+
+	// vCenter REST API
+	{"vcenter_host_connected", "Host connection state in vCenter (1=Connected, 0=Other)", []string{"host"}},
+	{"vcenter_host_powered_on", "Host power state in vCenter (1=Powered on, 0=Other)", []string{"host"}},
+	{"vcenter_vm_powered_on", "VM power state in vCenter (1=Powered on, 0=Other)", []string{"host", "vm"}},
+	{"vcenter_datastore_capacity_bytes", "Datastore capacity reported by vCenter in bytes", []string{"datastore", "type"}},
+	{"vcenter_datastore_free_bytes", "Datastore free space reported by vCenter in bytes", []string{"datastore", "type"}},
+	{"vcenter_alarm_triggered", "Alarm triggered in vCenter (always 1)", []string{"entity_type", "entity", "alarm", "status", "acknowledged"}},
+
+	// CIM server (CIM_NumericSensor, OMC_RawIpmiSensor, CIM_PhysicalDrive, VMware_StorageExtent)
+	{"cim_sensor_reading", "CIM sensor reading in its base unit", []string{"class", "device_id", "sensor", "type", "unit"}},
+	{"cim_sensor_health_state", "CIM sensor HealthState (0=Unknown, 5=OK, 10=Degraded, 15=Minor, 20=Major, 25=Critical, 30=Non-recoverable)", []string{"class", "device_id", "sensor", "type"}},
+	{"cim_drive_health_state", "CIM drive HealthState (0=Unknown, 5=OK, 10=Degraded, 15=Minor, 20=Major, 25=Critical, 30=Non-recoverable)", []string{"class", "device_id", "name"}},
+
+	// Redfish Chassis Thermal and Power (storage maps onto the controller and drive families)
+	{"redfish_temperature_celsius", "Chassis temperature reported by the BMC", []string{"chassis", "sensor"}},
+	{"redfish_fan_reading", "Chassis fan reading reported by the BMC", []string{"chassis", "fan", "unit"}},
+	{"redfish_fan_health", "Chassis fan health (1=OK, 0=Other)", []string{"chassis", "fan"}},
+	{"redfish_psu_health", "Power supply health (1=OK, 0=Other)", []string{"chassis", "psu"}},
+	{"redfish_power_consumed_watts", "Power consumed by the chassis in watts", []string{"chassis", "name"}},
+	{"redfish_voltage_volts", "Voltage reading reported by the BMC", []string{"chassis", "sensor"}},
+}
+
+// counterDefs lists every counter registered by NewMetrics
+var counterDefs = []metricDef{
+	// esxcli network nic stats get
+	{"nic_receive_packets_total", "Packets received by a physical NIC", []string{"nic"}},
+	{"nic_transmit_packets_total", "Packets sent by a physical NIC", []string{"nic"}},
+	{"nic_receive_bytes_total", "Bytes received by a physical NIC", []string{"nic"}},
+	{"nic_transmit_bytes_total", "Bytes sent by a physical NIC", []string{"nic"}},
+	{"nic_receive_errors_total", "Receive errors on a physical NIC", []string{"nic"}},
+	{"nic_transmit_errors_total", "Transmit errors on a physical NIC", []string{"nic"}},
+	{"nic_receive_drops_total", "Received packets dropped by a physical NIC", []string{"nic"}},
+	{"nic_transmit_drops_total", "Transmit packets dropped by a physical NIC", []string{"nic"}},
+	{"nic_receive_crc_errors_total", "Receive CRC errors on a physical NIC", []string{"nic"}},
+}
+
+// Definition describes a metric family exported by the collectors
+type Definition struct {
+	Name   string // full name, including the namespace
+	Help   string
+	Type   string // "gauge" or "counter"
+	Labels []string
+}
+
+// Definitions lists the gauges and counters registered by NewMetrics
+func Definitions() []Definition {
+	defs := make([]Definition, 0, len(metricDefs)+len(counterDefs))
+	for _, def := range metricDefs {
+		defs = append(defs, Definition{Name: Namespace + "_" + def.name, Help: def.help, Type: "gauge", Labels: def.labels})
+	}
+	for _, def := range counterDefs {
+		defs = append(defs, Definition{Name: Namespace + "_" + def.name, Help: def.help, Type: "counter", Labels: def.labels})
+	}
+	return defs
+}
+
+// collector is a named step of CollectMetrics
+type collector struct {
+	name    string
+	collect func(*Metrics) error
+	// configured is set for collectors that query an API from the config
+	// file instead of running commands on the host; they only run by
+	// default once configured
+	configured func(*config.Config) bool
+	// interval and jitter are the default schedule, see Run
+	interval time.Duration
+	jitter   time.Duration
+}
+
+// collectors lists every collector in the order CollectMetrics runs them.
+// Inventory runs first, also in Run, so the discovered FQDN is used as the
+// host label.
+var collectors = []collector{
+	{"inventory", (*Metrics).collectInventory, nil, 24 * time.Hour, 10 * time.Minute},
+	{"storage", (*Metrics).collectStorage, nil, time.Minute, 5 * time.Second},
+	{"smart", (*Metrics).collectSmart, nil, 15 * time.Minute, time.Minute},
+	{"enclosures", (*Metrics).collectEnclosures, nil, 5 * time.Minute, 30 * time.Second},
+	{"storage_paths", (*Metrics).collectStoragePaths, nil, 5 * time.Minute, 30 * time.Second},
+	{"datastores", (*Metrics).collectDatastores, nil, 5 * time.Minute, 30 * time.Second},
+	{"ipmi", (*Metrics).collectIpmi, nil, 5 * time.Minute, 30 * time.Second},
+	{"nics", (*Metrics).collectNics, nil, time.Minute, 5 * time.Second},
+	{"vsan", (*Metrics).collectVsan, nil, 5 * time.Minute, 30 * time.Second},
+	{"esxtop", (*Metrics).collectEsxtop, nil, time.Minute, 5 * time.Second},
+	{"vms", (*Metrics).collectVMs, nil, 5 * time.Minute, 30 * time.Second},
+	{"vcenter", (*Metrics).collectVcenter, func(cfg *config.Config) bool { return cfg.Vcenter.URL != "" }, 5 * time.Minute, 30 * time.Second},
+	{"wbem", (*Metrics).collectWbem, func(cfg *config.Config) bool { return cfg.Wbem.URL != "" }, 5 * time.Minute, 30 * time.Second},
+	{"redfish", (*Metrics).collectRedfish, func(cfg *config.Config) bool { return cfg.Redfish.URL != "" }, 5 * time.Minute, 30 * time.Second},
+}
+
+// selectCollectors resolves collector names, in table order. No names
+// selects every collector, API collectors only when they are configured.
+func selectCollectors(cfg *config.Config, names []string) ([]collector, error) {
+	wanted := make(map[string]bool)
+	for _, name := range names {
+		wanted[name] = true
+	}
+
+	selected := []collector{}
+	for _, c := range collectors {
+		if len(names) == 0 {
+			if c.configured == nil || c.configured(cfg) {
+				selected = append(selected, c)
+			}
+			continue
+		}
+		if wanted[c.name] {
+			selected = append(selected, c)
+			delete(wanted, c.name)
+		}
+	}
+	for name := range wanted {
+		return nil, fmt.Errorf("unknown collector %q", name)
+	}
+	return selected, nil
+}
+
+// HostCollectorNames lists the collectors that run commands on an ESXi
+// host, that is every collector except the API ones, plus redfish when
+// cfg configures the host's BMC
+func HostCollectorNames(cfg *config.Config) []string {
+	names := []string{}
+	for _, c := range collectors {
+		if c.configured == nil || c.name == "redfish" && c.configured(cfg) {
+			names = append(names, c.name)
+		}
+	}
+	return names
+}
+
 type Metrics struct {
+	// registry holds the metrics computed at scrape time
 	registry  *prometheus.Registry
 	namespace string
-	host      string
-	metrics   map[string]*prometheus.GaugeVec
+
+	// mtx guards the configuration shared by collector runs
+	mtx        sync.Mutex
+	host       string
+	config     *config.Config
+	executor   executor.Executor
+	collectors []collector
+	vcenter    *vcenter.Client
+	wbem       *wbem.Client
+	redfish    *redfish.Client
+	reschedule chan struct{}
+	// perccli is held while a controller-wide perccli query runs, shared by
+	// all runs; see runPerccli
+	perccli chan struct{}
+
+	// ctx, metrics and counters belong to a collector run, see newRun
+	ctx      context.Context
+	metrics  map[string]*prometheus.GaugeVec
+	counters map[string]*counterVec
+
+	snapshotMtx sync.RWMutex
+	snapshots   map[string]*snapshot
+	staleAfter  time.Duration
+
+	statusMtx sync.Mutex
+	status    map[string]CollectorStatus
+	ready     bool
 }
 
-// NewMetrics initializes a new Metrics instance with Prometheus gauges
-func NewMetrics() *Metrics {
+// NewMetrics initializes a new Metrics instance with Prometheus gauges.
+// Commands run through exec and only the named collectors are run (all of
+// them when names is empty).
+func NewMetrics(cfg *config.Config, exec executor.Executor, names []string) (*Metrics, error) {
+	selected, err := selectCollectors(cfg, names)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSchedules(cfg); err != nil {
+		return nil, err
+	}
+
 	m := &Metrics{
-		registry:  prometheus.NewRegistry(),
-		namespace: "esxi",
-		host:      "localhost",
-		metrics:   make(map[string]*prometheus.GaugeVec),
-	}
-
-	// Define Prometheus gauges
-	m.metrics["controller_info"] = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Namespace: m.namespace,
-			Name:      "controller_info",
-			Help:      "MegaRAID controller info",
-		},
-		[]string{"controller", "model", "serial", "fwversion"},
-	)
-	m.metrics["controller_status"] = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Namespace: m.namespace,
-			Name:      "controller_status",
-			Help:      "Controller status (1=Optimal, 0=Not Optimal)",
-		},
-		[]string{"controller"},
-	)
-	m.metrics["controller_temperature"] = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Namespace: m.namespace,
-			Name:      "controller_temperature",
-			Help:      "Controller temperature in Celsius",
-		},
-		[]string{"controller"},
-	)
-	m.metrics["drive_status"] = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Namespace: m.namespace,
-			Name:      "drive_status",
-			Help:      "Physical drive status (1=Online, 0=Other)",
-		},
-		[]string{"controller", "drive", "model_name", "protocol"},
-	)
-	m.metrics["drive_temp"] = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Namespace: m.namespace,
-			Name:      "drive_temp",
-			Help:      "Physical drive temperature in Celsius",
-		},
-		[]string{"controller", "drive"},
-	)
-	m.metrics["drive_smart"] = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Namespace: m.namespace,
-			Name:      "drive_smart",
-			Help:      "Drive SMART attributes",
-		},
-		[]string{"controller", "drive", "attribute"},
-	)
-	m.metrics["virtual_drive_status"] = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Namespace: m.namespace,
-			Name:      "virtual_drive_status",
-			Help:      "Virtual drive status (1=Optimal, 0=Other)",
-		},
-		[]string{"controller", "vd"},
-	)
-	m.metrics["bbu_health"] = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Namespace: m.namespace,
-			Name:      "bbu_health",
-			Help:      "Battery Backup Unit health (1=Healthy, 0=Unhealthy)",
-		},
-		[]string{"controller"},
-	)
-	m.metrics["smartctl_info"] = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Namespace: m.namespace,
-			Name:      "smartctl_info",
-			Help:      "Indicates smartctl is used for metrics collection (1=Active)",
-		},
-		[]string{"host"},
-	)
-	m.metrics["smartctl_drive"] = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Namespace: m.namespace,
-			Name:      "smartctl_drive",
-			Help:      "Lists drives detected via smartctl on ESXi host",
-		},
-		[]string{"host", "drive", "device_id", "model_name", "protocol"},
-	)
-
-	// Register all metrics
-	for _, metric := range m.metrics {
-		m.registry.MustRegister(metric)
-	}
-
-	return m
+		registry:   prometheus.NewRegistry(),
+		namespace:  Namespace,
+		host:       "localhost",
+		executor:   exec,
+		reschedule: make(chan struct{}, 1),
+		perccli:    make(chan struct{}, 1),
+		snapshots:  make(map[string]*snapshot),
+		status:     make(map[string]CollectorStatus),
+	}
+	m.setConfig(cfg, selected)
+	m.registry.MustRegister(newFreshnessCollector(m))
+
+	return m, nil
+}
+
+// SMART attributes watched by the generated rules and dashboard and by
+// `esxi_exporter check`
+const (
+	SmartReallocatedSectors = "reallocated_sector_count"
+	SmartPendingSectors     = "current_pending_sector_count"
+)
+
+// smartAttributeNames names SMART attributes by ID. smartctl rows are mapped
+// through it too, so both sources export the same attribute label.
+var smartAttributeNames = map[int]string{
+	0x01: "raw_read_error_rate", 0x03: "spin_up_time", 0x04: "start_stop_count", 0x05: SmartReallocatedSectors,
+	0x07: "seek_error_rate", 0x09: "power_on_hours", 0x0C: "power_cycle_count", 0x53: "initial_bad_block_count",
+	0xB1: "wear_leveling_count", 0xB3: "used_reserved_block_count_total", 0xB4: "unused_reserved_block_count_total",
+	0xB5: "program_fail_count_total", 0xB6: "erase_fail_count_total", 0xB7: "runtime_bad_block", 0xB8: "end_to_end_error",
+	0xBB: "uncorrectable_error_count", 0xBE: "airflow_temperature_celsius", 0xC2: "temperature_celsius", 0xC3: "hardware_ecc_recovered",
+	0xC5: SmartPendingSectors, 0xC6: "uncorrectable_sector_count", 0xC7: "udma_crc_error_count", 0xCA: "data_address_mark_errors",
+	0xEB: "por_recovery_count", 0xF1: "total_host_writes", 0xF2: "total_host_reads", 0xF3: "total_host_writes_expanded", 0xF4: "total_host_reads_expanded",
+	0xF5: "remaining_rated_write_endurance", 0xF6: "cumulative_host_sectors_written", 0xF7: "host_program_page_count", 0xFB: "minimum_spares_remaining",
 }
 
 // parseSmartData converts SMART data hex string to attributes
@@ -161,18 +375,7 @@ func (m *Metrics) parseSmartData(smartDataHex string) map[string]float64 {
 			rawValue |= int64(byteVal) << (k * 8)
 		}
 
-		attrNameMap := map[int]string{
-			0x01: "raw_read_error_rate", 0x03: "spin_up_time", 0x04: "start_stop_count", 0x05: "reallocated_sector_count",
-			0x07: "seek_error_rate", 0x09: "power_on_hours", 0x0C: "power_cycle_count", 0x53: "initial_bad_block_count",
-			0xB1: "wear_leveling_count", 0xB3: "used_reserved_block_count_total", 0xB4: "unused_reserved_block_count_total",
-			0xB5: "program_fail_count_total", 0xB6: "erase_fail_count_total", 0xB7: "runtime_bad_block", 0xB8: "end_to_end_error",
-			0xBB: "uncorrectable_error_count", 0xBE: "airflow_temperature_celsius", 0xC2: "temperature_celsius", 0xC3: "hardware_ecc_recovered",
-			0xC5: "current_pending_sector_count", 0xC6: "uncorrectable_sector_count", 0xC7: "udma_crc_error_count", 0xCA: "data_address_mark_errors",
-			0xEB: "por_recovery_count", 0xF1: "total_host_writes", 0xF2: "total_host_reads", 0xF3: "total_host_writes_expanded", 0xF4: "total_host_reads_expanded",
-			0xF5: "remaining_rated_write_endurance", 0xF6: "cumulative_host_sectors_written", 0xF7: "host_program_page_count", 0xFB: "minimum_spares_remaining",
-		}
-
-		attrName, ok := attrNameMap[attrID]
+		attrName, ok := smartAttributeNames[attrID]
 		if !ok {
 			attrName = "unknown_" + strconv.FormatInt(int64(attrID), 16)
 		}
@@ -194,98 +397,75 @@ func (m *Metrics) parseSmartData(smartDataHex string) map[string]float64 {
 	return attributes
 }
 
-// discoverEsxcliDevices discovers devices using esxcli
-func (m *Metrics) discoverEsxcliDevices() []map[string]string {
+// discoverEsxcliDevices maps esxcli storage devices to the drive labels used by the smartctl fallback
+func (m *Metrics) discoverEsxcliDevices(devices []esxcli.Record) []map[string]string {
 	detectedDevices := []map[string]string{}
 
-	output, err := m.runCmd("esxcli storage core device list")
-	if err != nil {
-		log.Printf("Error discovering esxcli devices: %v", err)
-		return detectedDevices
-	}
-
-	currentDeviceInfo := make(map[string]string)
-	lines := strings.Split(output, "\n")
-
-	deviceRegex, _ := regexp.Compile(`^(naa\.\S+|t10\.\S+|mpx\.\S+)$`)
-	ssdRegex, _ := regexp.Compile(`Is SSD:\s*true`)
-
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-
-		deviceIDMatch := deviceRegex.MatchString(line)
-		if deviceIDMatch {
-			if len(currentDeviceInfo) > 0 {
-				deviceID, displayName := currentDeviceInfo["id"], currentDeviceInfo["display_name"]
-				model, protocol := currentDeviceInfo["model"], currentDeviceInfo["protocol"]
-				if deviceID != "" && displayName != "" {
-					detectedDevices = append(detectedDevices, map[string]string{
-						"id":           deviceID,
-						"display_name": displayName,
-						"model":        model,
-						"protocol":     protocol,
-					})
-				}
-			}
-			currentDeviceInfo = map[string]string{"id": line}
+	for _, device := range devices {
+		deviceID := device.Get("Device", "")
+		displayName := displayNameSuffix.ReplaceAllString(device.Get("DisplayName", ""), "")
+		if deviceID == "" || displayName == "" {
 			continue
 		}
 
-		if len(currentDeviceInfo) > 0 {
-			displayNameMatch := regexp.MustCompile(`Display Name:\s*(.+)`).FindStringSubmatch(line)
-			if len(displayNameMatch) > 1 {
-				rawDisplayName := strings.TrimSpace(displayNameMatch[1])
-				cleanedDisplayName := regexp.MustCompile(`\s*\([^)]+\)$`).ReplaceAllString(rawDisplayName, "")
-				currentDeviceInfo["display_name"] = cleanedDisplayName
-				continue
+		protocol := ""
+		if device.Bool("IsSSD") {
+			protocol = "SSD"
+		}
+		for _, key := range []string{"DisplayName", "Devfspath", "MultipathPlugin", "DriveType"} {
+			if strings.Contains(strings.ToLower(device[key]), "nvme") {
+				protocol = "NVMe"
+				break
 			}
+		}
 
-			modelMatch := regexp.MustCompile(`Model:\s*(.+)`).FindStringSubmatch(line)
-			if len(modelMatch) > 1 {
-				currentDeviceInfo["model"] = strings.TrimSpace(modelMatch[1])
-				continue
-			}
+		detectedDevices = append(detectedDevices, map[string]string{
+			"id":           deviceID,
+			"display_name": displayName,
+			"model":        device.Get("Model", ""),
+			"protocol":     protocol,
+		})
+	}
 
-			isSSdMatch := ssdRegex.MatchString(strings.ToLower(line))
-			if isSSdMatch {
-				currentDeviceInfo["protocol"] = "SSD"
-				continue
-			}
+	return detectedDevices
+}
 
-			if strings.Contains(strings.ToLower(line), "nvme") {
-				currentDeviceInfo["protocol"] = "NVMe"
-			}
+// smartAttributeTable returns the lines of the smartctl attribute table, from
+// its header up to Total_LBAs_Written or the end of the table
+func smartAttributeTable(output string) []string {
+	lines := strings.Split(output, "\n")
+	for i, line := range lines {
+		if !strings.Contains(line, "ID# ATTRIBUTE_NAME") {
+			continue
 		}
-	}
-
-	if len(currentDeviceInfo) > 0 {
-		deviceID, displayName := currentDeviceInfo["id"], currentDeviceInfo["display_name"]
-		model, protocol := currentDeviceInfo["model"], currentDeviceInfo["protocol"]
-		if deviceID != "" && displayName != "" {
-			detectedDevices = append(detectedDevices, map[string]string{
-				"id":           deviceID,
-				"display_name": displayName,
-				"model":        model,
-				"protocol":     protocol,
-			})
+		for j := i + 1; j < len(lines); j++ {
+			if strings.Contains(lines[j], "Total_LBAs_Written") {
+				return lines[i : j+1]
+			}
+			if strings.TrimSpace(lines[j]) == "" {
+				return lines[i:j]
+			}
 		}
+		return lines[i:]
 	}
-
-	return detectedDevices
+	return nil
 }
 
 // parseEsxcliSmart parses SMART data from esxcli/smartctl
-func (m *Metrics) parseEsxcliSmart(deviceID string) map[string]float64 {
+func (m *Metrics) parseEsxcliSmart(ctx context.Context, deviceID string) map[string]float64 {
 	smartAttributes := make(map[string]float64)
-	cmd := "cd /opt/smartmontools && ./smartctl -a -d sat /dev/disks/" + deviceID + " | awk '/ID# ATTRIBUTE_NAME/,/Total_LBAs_Written/'"
-	output, err := m.runCmd(cmd)
+	output, err := m.runCmdContext(ctx, smartctlDir, smartctlDir+"/smartctl", "-a", "-d", "sat", "/dev/disks/"+deviceID)
+	// smartctl exit codes are a bit mask; only bits 0 and 1 (bad command
+	// line, device open failed) mean there is no attribute table to read
+	if cmdErr, ok := err.(*models.CommandError); ok && cmdErr.ExitCode > 0 && cmdErr.ExitCode&0x3 == 0 {
+		err = nil
+	}
 	if err != nil {
 		log.Printf("smartctl get failed for %s: %v. This is expected for logical drives.", deviceID, err)
 		return smartAttributes
 	}
 
-	lines := strings.Split(output, "\n")
-	for _, line := range lines {
+	for _, line := range smartAttributeTable(output) {
 		line = strings.TrimSpace(line)
 		if strings.HasPrefix(line, "ID#") || line == "" {
 			continue
@@ -304,7 +484,14 @@ func (m *Metrics) parseEsxcliSmart(deviceID string) map[string]float64 {
 			continue
 		}
 
+		// smartctl names vary between drive databases ("Reallocated_Sector_Ct");
+		// known IDs take the perccli names instead
 		attrKey := strings.ToLower(strings.ReplaceAll(attrName, "-", "_"))
+		if id, err := strconv.Atoi(tokens[0]); err == nil {
+			if name, ok := smartAttributeNames[id]; ok {
+				attrKey = name
+			}
+		}
 		if attrKey == "wear_leveling_count" {
 			valueFloat, err := strconv.ParseFloat(value, 64)
 			if err == nil {
@@ -318,96 +505,140 @@ func (m *Metrics) parseEsxcliSmart(deviceID string) map[string]float64 {
 	return smartAttributes
 }
 
-// CollectMetrics collects and sets metrics for Prometheus
-func (m *Metrics) CollectMetrics() {
-	// Reset metrics to ensure fresh data on each scrape
-	for _, metric := range m.metrics {
-		metric.Reset()
-	}
+// Host returns the host label of the metrics, the FQDN once inventory has run
+func (m *Metrics) Host() string {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.host
+}
 
-	perccliData := make(map[string]interface{})
-	perccliFailed := false
+// SetHost sets the host label used until inventory discovers the host FQDN
+func (m *Metrics) SetHost(host string) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.host = host
+}
 
-	stdout, err := m.runCmd("cd /opt/lsi/perccli && ./perccli /cALL show all J")
-	if err != nil {
-		perccliFailed = true
-		log.Printf("perccli command failed: %v. Falling back to esxcli.", err)
-	} else {
-		if err := json.Unmarshal([]byte(stdout), &perccliData); err != nil {
-			perccliFailed = true
-			log.Printf("Failed to decode JSON from perccli output: %v. Falling back to esxcli.", err)
-		} else {
-			controllers, ok := perccliData["Controllers"].([]interface{})
-			if !ok || len(controllers) == 0 {
-				perccliFailed = true
-				log.Println("perccli returned no controller data. Falling back to esxcli.")
-			} else {
-				firstController, ok := controllers[0].(map[string]interface{})
-				if ok {
-					commandStatus, ok := firstController["Command Status"].(map[string]interface{})
-					if ok && commandStatus["Status"] == "Failure" && strings.Contains(commandStatus["Description"].(string), "No Controller found") {
-						perccliFailed = true
-						log.Println("perccli reported 'No Controller found'. Falling back to esxcli.")
-					}
-				}
-			}
+// Gatherer returns the metrics of the last completed collection along with
+// their freshness
+func (m *Metrics) Gatherer() prometheus.Gatherer {
+	return prometheus.Gatherers{snapshotGatherer{m}, m.registry}
+}
+
+// CollectMetrics runs every selected collector once, one after another.
+// Collectors cut short or never started because ctx is done are published
+// as failed: probes and one-shot collections have no earlier run to serve.
+func (m *Metrics) CollectMetrics(ctx context.Context) {
+	m.mtx.Lock()
+	selected := m.collectors
+	m.mtx.Unlock()
+
+	for _, c := range selected {
+		start := time.Now()
+		if ctx.Err() == nil && m.runCollector(ctx, c) {
+			continue
 		}
+		m.publishFailure(c.name, start, ctx.Err())
+	}
+}
+
+// collectStorage collects controller, virtual and physical drive metrics via perccli, falling back to esxcli
+func (m *Metrics) collectStorage() error {
+	storageDevices, devicesErr := m.collectStorageDevices()
+	if devicesErr != nil {
+		log.Printf("Error discovering esxcli devices: %v", devicesErr)
 	}
 
-	if !perccliFailed {
+	controllers, err := m.perccliControllers()
+	if err == nil {
 		log.Println("perccli found controllers. Processing perccli data.")
-		controllers := perccliData["Controllers"].([]interface{})
-		for _, controller := range controllers {
-			response, ok := controller.(map[string]interface{})["Response Data"].(map[string]interface{})
-			if !ok {
-				continue
-			}
+		for _, response := range controllers {
 			m.handleCommonController(response)
-			driverName := helpers.GetString(response["Version"].(map[string]interface{}), "Driver Name", "Unknown")
-			if driverName == "megaraid_sas" || driverName == "lsi-mr3" {
+			if isMegaraid(response) {
 				m.handleMegaraidController(response)
 			}
 		}
-	} else {
-		log.Println("perccli not used. Discovering and processing devices via esxcli.")
-		m.metrics["smartctl_info"].With(prometheus.Labels{"host": m.host}).Set(1)
-		esxcliDevices := m.discoverEsxcliDevices()
-		for _, device := range esxcliDevices {
-			deviceID, displayName := device["id"], device["display_name"]
-			model, protocol := device["model"], device["protocol"]
-			if model == "" {
-				model = "Unknown"
-			}
-			if protocol == "" {
-				protocol = "Unknown"
-			}
-			m.metrics["smartctl_drive"].With(prometheus.Labels{
-				"host":       m.host,
-				"drive":      displayName,
-				"device_id":  deviceID,
-				"model_name": model,
-				"protocol":   protocol,
-			}).Set(1)
-			m.metrics["drive_status"].With(prometheus.Labels{
-				"controller": "esxcli",
-				"drive":      displayName,
-				"model_name": model,
-				"protocol":   protocol,
-			}).Set(1) // Assuming status=1 for detected drives
-			smartAttrs := m.parseEsxcliSmart(deviceID)
-			if len(smartAttrs) > 0 {
-				for attr, value := range smartAttrs {
-					m.metrics["drive_smart"].With(prometheus.Labels{
-						"controller": "esxcli",
-						"drive":      displayName,
-						"attribute":  attr,
-					}).Set(value)
-				}
-			} else {
-				log.Printf("No SMART data collected via esxcli for device: %s (%s)", displayName, deviceID)
-			}
+		return nil
+	}
+
+	log.Printf("%v. Falling back to esxcli.", err)
+	m.metrics["smartctl_info"].With(prometheus.Labels{"host": m.host}).Set(1)
+	for _, device := range m.discoverEsxcliDevices(storageDevices) {
+		deviceID, displayName := device["id"], device["display_name"]
+		model, protocol := device["model"], device["protocol"]
+		if model == "" {
+			model = "Unknown"
+		}
+		if protocol == "" {
+			protocol = "Unknown"
+		}
+		m.metrics["smartctl_drive"].With(prometheus.Labels{
+			"host":       m.host,
+			"drive":      displayName,
+			"device_id":  deviceID,
+			"model_name": model,
+			"protocol":   protocol,
+		}).Set(1)
+		m.metrics["drive_status"].With(prometheus.Labels{
+			"controller": "esxcli",
+			"drive":      displayName,
+			"model_name": model,
+			"protocol":   protocol,
+			"source":     "smartctl",
+		}).Set(1) // Assuming status=1 for detected drives
+	}
+	return devicesErr
+}
+
+// perccliControllers returns the "Response Data" of every controller
+// reported by perccli, or an error when perccli is unusable on this host
+func (m *Metrics) perccliControllers() ([]map[string]interface{}, error) {
+	stdout, err := m.runPerccli("/cALL", "show", "all", "J")
+	if err != nil {
+		return nil, fmt.Errorf("perccli command failed: %v", err)
+	}
+	perccliData := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(stdout), &perccliData); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON from perccli output: %v", err)
+	}
+	controllers, ok := perccliData["Controllers"].([]interface{})
+	if !ok || len(controllers) == 0 {
+		return nil, fmt.Errorf("perccli returned no controller data")
+	}
+	if firstController, ok := controllers[0].(map[string]interface{}); ok {
+		commandStatus, ok := firstController["Command Status"].(map[string]interface{})
+		if ok && commandStatus["Status"] == "Failure" && strings.Contains(helpers.GetString(commandStatus, "Description", ""), "No Controller found") {
+			return nil, fmt.Errorf("perccli reported 'No Controller found'")
+		}
+	}
+
+	responses := []map[string]interface{}{}
+	for _, controller := range controllers {
+		controllerMap, ok := controller.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if response, ok := controllerMap["Response Data"].(map[string]interface{}); ok {
+			responses = append(responses, response)
 		}
 	}
+	return responses, nil
+}
+
+// isMegaraid reports whether a controller runs the MegaRAID driver
+func isMegaraid(response map[string]interface{}) bool {
+	version, _ := response["Version"].(map[string]interface{})
+	driverName := helpers.GetString(version, "Driver Name", "Unknown")
+	return driverName == "megaraid_sas" || driverName == "lsi-mr3"
+}
+
+// driveSlot splits the "EID:Slt" of a PD LIST entry
+func driveSlot(physicalDrive map[string]interface{}) (string, string) {
+	parts := strings.SplitN(helpers.GetString(physicalDrive, "EID:Slt", "0:0"), ":", 2)
+	if len(parts) != 2 {
+		return parts[0], "0"
+	}
+	return parts[0], parts[1]
 }
 
 // handleCommonController processes common controller metrics
@@ -426,13 +657,14 @@ func (m *Metrics) handleCommonController(response map[string]interface{}) {
 		"model":      model,
 		"serial":     serial,
 		"fwversion":  fwversion,
+		"source":     "perccli",
 	}).Set(1)
 
 	statusMap, ok := response["Status"].(map[string]interface{})
 	if ok && statusMap["Controller Status"] == "Optimal" {
-		m.metrics["controller_status"].With(prometheus.Labels{"controller": controllerIndex}).Set(1)
+		m.metrics["controller_status"].With(prometheus.Labels{"controller": controllerIndex, "source": "perccli"}).Set(1)
 	} else {
-		m.metrics["controller_status"].With(prometheus.Labels{"controller": controllerIndex}).Set(0)
+		m.metrics["controller_status"].With(prometheus.Labels{"controller": controllerIndex, "source": "perccli"}).Set(0)
 	}
 
 	hwCfg, ok := response["HwCfg"].(map[string]interface{})
@@ -440,7 +672,7 @@ func (m *Metrics) handleCommonController(response map[string]interface{}) {
 		for _, key := range []string{"ROC temperature(Degree Celcius)", "ROC temperature(Degree Celsius)"} {
 			if temp, ok := hwCfg[key]; ok {
 				if tempFloat, err := strconv.ParseFloat(temp.(string), 64); err == nil {
-					m.metrics["controller_temperature"].With(prometheus.Labels{"controller": controllerIndex}).Set(tempFloat)
+					m.metrics["controller_temperature"].With(prometheus.Labels{"controller": controllerIndex, "source": "perccli"}).Set(tempFloat)
 				}
 				break
 			}
@@ -459,16 +691,11 @@ func (m *Metrics) handleMegaraidController(response map[string]interface{}) {
 			if !ok {
 				continue
 			}
-			eidSlt := helpers.GetString(driveMap, "EID:Slt", "0:0")
-			parts := strings.SplitN(eidSlt, ":", 2)
-			enclosure, slot := parts[0], parts[1]
-			drivePath := "/c" + controllerIndex + "/e" + enclosure + "/s" + slot
-			smartData := m.getPerccliSmart(drivePath)
-			smartAttributes := m.parseSmartData(smartData)
-			m.createMetricsOfPhysicalDrive(driveMap, controllerIndex, smartAttributes)
+			m.createMetricsOfPhysicalDrive(driveMap, controllerIndex)
 		}
 	}
 
+	vdDevices := m.getPerccliVdDevices(controllerIndex)
 	vdList, ok := response["VD LIST"].([]interface{})
 	if ok {
 		for _, vd := range vdList {
@@ -487,7 +714,16 @@ func (m *Metrics) handleMegaraidController(response map[string]interface{}) {
 			m.metrics["virtual_drive_status"].With(prometheus.Labels{
 				"controller": controllerIndex,
 				"vd":         vdID,
+				"source":     "perccli",
 			}).Set(status)
+			if deviceID, ok := vdDevices[vdID]; ok {
+				m.metrics["virtual_drive_info"].With(prometheus.Labels{
+					"controller": controllerIndex,
+					"vd":         vdID,
+					"device_id":  deviceID,
+					"source":     "perccli",
+				}).Set(1)
+			}
 		}
 	}
 
@@ -499,20 +735,30 @@ func (m *Metrics) handleMegaraidController(response map[string]interface{}) {
 				bbuHealth = 1
 			}
 		}
-		m.metrics["bbu_health"].With(prometheus.Labels{"controller": controllerIndex}).Set(bbuHealth)
+		m.metrics["bbu_health"].With(prometheus.Labels{"controller": controllerIndex, "source": "perccli"}).Set(bbuHealth)
 	}
 }
 
+// drive_status values; any other state is 0. Hot spares and unconfigured
+// good drives are healthy without being online.
+const (
+	driveOnline           = 1
+	driveHotSpare         = 2
+	driveUnconfiguredGood = 3
+)
+
 // createMetricsOfPhysicalDrive sets metrics for a physical drive
-func (m *Metrics) createMetricsOfPhysicalDrive(physicalDrive map[string]interface{}, controllerIndex string, smartAttributes map[string]float64) {
-	eidSlt := helpers.GetString(physicalDrive, "EID:Slt", "0:0")
-	parts := strings.SplitN(eidSlt, ":", 2)
-	enclosure, slot := parts[0], parts[1]
+func (m *Metrics) createMetricsOfPhysicalDrive(physicalDrive map[string]interface{}, controllerIndex string) {
+	enclosure, slot := driveSlot(physicalDrive)
 	driveIdentifier := "Drive /c" + controllerIndex + "/e" + enclosure + "/s" + slot
-	state := helpers.GetString(physicalDrive, "State", "Unknown")
 	var status float64
-	if state == "Onln" {
-		status = 1
+	switch helpers.GetString(physicalDrive, "State", "Unknown") {
+	case "Onln":
+		status = driveOnline
+	case "GHS", "DHS":
+		status = driveHotSpare
+	case "UGood":
+		status = driveUnconfiguredGood
 	}
 	modelName := helpers.GetString(physicalDrive, "Model", "Unknown")
 	protocol := helpers.GetString(physicalDrive, "Intf", "Unknown")
@@ -522,6 +768,7 @@ func (m *Metrics) createMetricsOfPhysicalDrive(physicalDrive map[string]interfac
 		"drive":      driveIdentifier,
 		"model_name": modelName,
 		"protocol":   protocol,
+		"source":     "perccli",
 	}).Set(status)
 
 	if temp, ok := physicalDrive["Temp"]; ok {
@@ -530,25 +777,71 @@ func (m *Metrics) createMetricsOfPhysicalDrive(physicalDrive map[string]interfac
 			m.metrics["drive_temp"].With(prometheus.Labels{
 				"controller": controllerIndex,
 				"drive":      driveIdentifier,
+				"source":     "perccli",
 			}).Set(tempFloat)
 		} else {
 			log.Printf("Could not parse temperature for %s: %v", driveIdentifier, temp)
 		}
 	}
+}
+
+// getPerccliVdDevices maps virtual drives ("DG0/VD0") to the naa device ID ESXi exposes for them
+func (m *Metrics) getPerccliVdDevices(controllerIndex string) map[string]string {
+	vdDevices := make(map[string]string)
+
+	stdout, err := m.runPerccli("/c"+controllerIndex+"/vall", "show", "all", "J")
+	if err != nil {
+		log.Printf("Error getting virtual drive properties for controller %s: %v", controllerIndex, err)
+		return vdDevices
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(stdout), &data); err != nil {
+		log.Printf("Failed to decode virtual drive properties for controller %s: %v", controllerIndex, err)
+		return vdDevices
+	}
+	controllers, ok := data["Controllers"].([]interface{})
+	if !ok || len(controllers) == 0 {
+		return vdDevices
+	}
+	response, ok := controllers[0].(map[string]interface{})["Response Data"].(map[string]interface{})
+	if !ok {
+		return vdDevices
+	}
 
-	for attr, value := range smartAttributes {
-		m.metrics["drive_smart"].With(prometheus.Labels{
-			"controller": controllerIndex,
-			"drive":      driveIdentifier,
-			"attribute":  attr,
-		}).Set(value)
+	// Each VD appears as "/cX/vN" (a one-row VD list) and "VDN Properties"
+	for key, value := range response {
+		parts := strings.SplitN(key, "/v", 2)
+		if len(parts) != 2 || !strings.HasPrefix(key, "/c") {
+			continue
+		}
+		rows, ok := value.([]interface{})
+		if !ok || len(rows) == 0 {
+			continue
+		}
+		row, ok := rows[0].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		properties, ok := response["VD"+parts[1]+" Properties"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		naa := helpers.GetString(properties, "SCSI NAA Id", "")
+		if naa == "" {
+			continue
+		}
+		position := strings.SplitN(helpers.GetString(row, "DG/VD", "0/0"), "/", 2)
+		if len(position) != 2 {
+			continue
+		}
+		vdDevices["DG"+position[0]+"/VD"+position[1]] = "naa." + naa
 	}
+	return vdDevices
 }
 
 // getPerccliSmart retrieves SMART data for a drive
-func (m *Metrics) getPerccliSmart(drivePath string) string {
-	cmd := "cd /opt/lsi/perccli && ./perccli " + drivePath + " show smart"
-	output, err := m.runCmd(cmd)
+func (m *Metrics) getPerccliSmart(ctx context.Context, drivePath string) string {
+	output, err := m.runPerccliDrive(ctx, drivePath, "show", "smart")
 	if err != nil {
 		log.Printf("Error getting SMART data for %s: %v", drivePath, err)
 		return ""
@@ -563,33 +856,44 @@ func (m *Metrics) getPerccliSmart(drivePath string) string {
 	return strings.ReplaceAll(matches[1], "\n", "")
 }
 
-// runCmd executes a shell command with a timeout
-func (m *Metrics) runCmd(command string) (string, error) {
-	cmd := exec.Command("bash", "-c", command)
-	var output strings.Builder
-	cmd.Stdout = &output
-	var stderr strings.Builder
-	cmd.Stderr = &stderr
+// runCmd runs a program on the host through the executor, in dir unless
+// empty. Commands are bounded by the run's context and command_timeout.
+func (m *Metrics) runCmd(dir string, args ...string) (string, error) {
+	return m.runCmdContext(m.ctx, dir, args...)
+}
 
-	if err := cmd.Start(); err != nil {
-		log.Printf("Error starting command: %v", err)
-		return "", err
+// runCmdContext is runCmd bounded by ctx instead of the run's context
+func (m *Metrics) runCmdContext(ctx context.Context, dir string, args ...string) (string, error) {
+	if m.config.CommandTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.config.CommandTimeout)
+		defer cancel()
 	}
+	return m.executor.Run(ctx, executor.Command{Dir: dir, Args: args})
+}
 
-	done := make(chan error, 1)
-	go func() {
-		done <- cmd.Wait()
-	}()
+// runPerccli runs perccli from its install directory, where it writes its
+// logs. perccli's controller-wide queries aren't safe to run concurrently,
+// so the collectors querying the controllers take turns.
+func (m *Metrics) runPerccli(args ...string) (string, error) {
+	return m.runPerccliContext(m.ctx, args...)
+}
 
+// runPerccliContext is runPerccli bounded by ctx instead of the run's context
+func (m *Metrics) runPerccliContext(ctx context.Context, args ...string) (string, error) {
 	select {
-	case <-time.After(30 * time.Second):
-		cmd.Process.Kill()
-		return "", &models.TimeoutError{Stderr: stderr.String(), Message: "Command timed out after 30 seconds"}
-	case err := <-done:
-		if err != nil {
-			log.Printf("Command failed: %v", stderr.String())
-			return "", err
-		}
-		return output.String(), nil
+	case m.perccli <- struct{}{}:
+	case <-ctx.Done():
+		return "", ctx.Err()
 	}
+	defer func() { <-m.perccli }()
+	return m.runPerccliDrive(ctx, args...)
+}
+
+// runPerccliDrive runs a per-drive perccli command without taking turns
+// with the controller-wide queries. The smart collector bounds these reads
+// through smart.workers and smart.per_controller, so a long SMART pass
+// doesn't hold up the storage and enclosures collectors.
+func (m *Metrics) runPerccliDrive(ctx context.Context, args ...string) (string, error) {
+	return m.runCmdContext(ctx, perccliDir, append([]string{perccliDir + "/perccli"}, args...)...)
 }
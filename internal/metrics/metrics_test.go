@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"context"
+	"esxi_exporter/internal/config"
+	"esxi_exporter/internal/executor"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// A probe that runs out of time still reports every collector, as failed
+func TestCollectMetricsTimeout(t *testing.T) {
+	hang := execFunc(func(ctx context.Context, command executor.Command) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	})
+	pm, err := NewMetrics(config.Default(), hang, []string{"inventory", "storage_paths"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	pm.CollectMetrics(ctx)
+
+	want := map[string]float64{"collector=inventory": 0, "collector=storage_paths": 0}
+	if got := gauges(t, pm.Gatherer(), "collector_success"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got collector_success %v, want %v", got, want)
+	}
+	for _, s := range pm.Status() {
+		if s.LastRun.IsZero() || s.Err == "" {
+			t.Errorf("got status %+v, want a failed run", s)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"esxi_exporter/internal/esxcli"
+	"esxi_exporter/internal/helpers"
+	"log"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// nicCounters maps esxcli network nic stats fields (lowercased, spaces
+// removed) to the counters they feed
+var nicCounters = map[string]string{
+	"packetsreceived":        "nic_receive_packets_total",
+	"packetssent":            "nic_transmit_packets_total",
+	"bytesreceived":          "nic_receive_bytes_total",
+	"bytessent":              "nic_transmit_bytes_total",
+	"totalreceiveerrors":     "nic_receive_errors_total",
+	"totaltransmiterrors":    "nic_transmit_errors_total",
+	"receivepacketsdropped":  "nic_receive_drops_total",
+	"transmitpacketsdropped": "nic_transmit_drops_total",
+	"receivecrcerrors":       "nic_receive_crc_errors_total",
+}
+
+// normalizeField lowercases an esxcli field name and strips its spaces so
+// that both "Packets received" and "Packetsreceived" match
+func normalizeField(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), ""))
+}
+
+// collectNics exports physical NIC link state, driver details and traffic counters
+func (m *Metrics) collectNics() error {
+	nics, err := m.runEsxcli("network", "nic", "list")
+	if err != nil {
+		return err
+	}
+
+	for _, nic := range nics {
+		name := nic.Get("Name", "")
+		if name == "" {
+			continue
+		}
+		labels := prometheus.Labels{"nic": name}
+
+		details, err := m.getEsxcliRecord("network", "nic", "get", "-n", name)
+		if err != nil {
+			log.Printf("Error getting details for %s: %v", name, err)
+			details = esxcli.Record{}
+		}
+		m.metrics["nic_info"].With(prometheus.Labels{
+			"nic":              name,
+			"driver":           details.First(nic.Get("Driver", "Unknown"), "DriverInfo.Driver"),
+			"driver_version":   details.Get("DriverInfo.Version", "Unknown"),
+			"firmware_version": details.Get("DriverInfo.FirmwareVersion", "Unknown"),
+			"mac":              nic.Get("MACAddress", "Unknown"),
+			"pci_device":       nic.Get("PCIDevice", "Unknown"),
+		}).Set(1)
+
+		m.metrics["nic_link_up"].With(labels).Set(helpers.BoolToFloat(strings.EqualFold(nic.Get("LinkStatus", ""), "Up")))
+		m.metrics["nic_admin_up"].With(labels).Set(helpers.BoolToFloat(strings.EqualFold(nic.Get("AdminStatus", ""), "Up")))
+		m.metrics["nic_full_duplex"].With(labels).Set(helpers.BoolToFloat(strings.EqualFold(nic.Get("Duplex", ""), "Full")))
+		// esxcli reports the negotiated speed in Mbit/s
+		if speed, ok := nic.Float("Speed"); ok {
+			m.metrics["nic_speed_bytes"].With(labels).Set(speed * 1000 * 1000 / 8)
+		}
+		if mtu, ok := nic.Float("MTU"); ok {
+			m.metrics["nic_mtu_bytes"].With(labels).Set(mtu)
+		}
+
+		stats, err := m.getEsxcliRecord("network", "nic", "stats", "get", "-n", name)
+		if err != nil {
+			log.Printf("Error getting statistics for %s: %v", name, err)
+			continue
+		}
+		for field := range stats {
+			counter, ok := nicCounters[normalizeField(field)]
+			if !ok {
+				continue
+			}
+			if value, ok := stats.Float(field); ok {
+				m.counters[counter].Set(labels, value)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,254 @@
+package metrics
+
+import (
+	"esxi_exporter/internal/helpers"
+	"esxi_exporter/internal/redfish"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// collectRedfish exports controller, drive and volume state plus chassis
+// thermal and power readings from the BMC, out of band of the host
+func (m *Metrics) collectRedfish() error {
+	if m.config.Redfish.URL == "" {
+		return fmt.Errorf("redfish url is not configured")
+	}
+
+	systems, err := m.redfish.Members("/redfish/v1/Systems")
+	if err != nil {
+		return err
+	}
+	layout := m.perccliLayout()
+	for _, systemLink := range systems {
+		var system redfish.System
+		if err := m.redfish.Get(systemLink.ID, &system); err != nil {
+			log.Printf("Error reading Redfish system %s: %v", systemLink.ID, err)
+			continue
+		}
+		if system.Storage.ID == "" {
+			continue
+		}
+		storages, err := m.redfish.Members(system.Storage.ID)
+		if err != nil {
+			log.Printf("Error listing Redfish storage of %s: %v", system.ID, err)
+			continue
+		}
+		for _, storageLink := range storages {
+			var storage redfish.Storage
+			if err := m.redfish.Get(storageLink.ID, &storage); err != nil {
+				log.Printf("Error reading Redfish storage %s: %v", storageLink.ID, err)
+				continue
+			}
+			m.exportRedfishStorage(storage, layout)
+		}
+	}
+
+	chassisList, err := m.redfish.Members("/redfish/v1/Chassis")
+	if err != nil {
+		return err
+	}
+	for _, chassisLink := range chassisList {
+		var chassis redfish.Chassis
+		if err := m.redfish.Get(chassisLink.ID, &chassis); err != nil {
+			log.Printf("Error reading Redfish chassis %s: %v", chassisLink.ID, err)
+			continue
+		}
+		m.exportRedfishChassis(chassis)
+	}
+
+	return nil
+}
+
+// perccliController is where perccli places a controller: its index and
+// the enclosure of each slot, "" when several enclosures share the slot
+type perccliController struct {
+	index      string
+	enclosures map[string]string
+}
+
+// perccliLayout returns the perccli controllers by serial number, so the
+// controllers and drives the BMC reports get the labels of their in-band
+// series. It is empty when perccli is unusable on this host.
+func (m *Metrics) perccliLayout() map[string]perccliController {
+	layout := make(map[string]perccliController)
+	controllers, err := m.perccliControllers()
+	if err != nil {
+		return layout
+	}
+	for _, response := range controllers {
+		basics, _ := response["Basics"].(map[string]interface{})
+		serial := helpers.GetString(basics, "Serial Number", "")
+		if serial == "" {
+			continue
+		}
+		controller := perccliController{
+			index:      helpers.GetString(basics, "Controller", "Unknown"),
+			enclosures: make(map[string]string),
+		}
+		pdList, _ := response["PD LIST"].([]interface{})
+		for _, drive := range pdList {
+			driveMap, ok := drive.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			enclosure, slot := driveSlot(driveMap)
+			if seen, ok := controller.enclosures[slot]; ok && seen != enclosure {
+				enclosure = ""
+			}
+			controller.enclosures[slot] = enclosure
+		}
+		layout[serial] = controller
+	}
+	return layout
+}
+
+// redfishDriveSlot returns the bay of an iDRAC drive ID such as
+// "Disk.Bay.0:Enclosure.Internal.0-1:RAID.Integrated.1-1"
+func redfishDriveSlot(id string) (string, bool) {
+	bay := strings.SplitN(id, ":", 2)[0]
+	if !strings.HasPrefix(bay, "Disk.Bay.") {
+		return "", false
+	}
+	return strings.TrimPrefix(bay, "Disk.Bay."), true
+}
+
+// exportRedfishStorage maps a Redfish Storage resource onto the controller
+// and drive families. Controllers perccli also sees, and their drives, are
+// labelled the way perccli labels them.
+func (m *Metrics) exportRedfishStorage(storage redfish.Storage, layout map[string]perccliController) {
+	controllerIndex := storage.ID
+	var inBand *perccliController
+	if len(storage.StorageControllers) == 1 {
+		if controller, ok := layout[storage.StorageControllers[0].SerialNumber]; ok {
+			controllerIndex, inBand = controller.index, &controller
+		}
+	}
+
+	for _, controller := range storage.StorageControllers {
+		m.metrics["controller_info"].With(prometheus.Labels{
+			"controller": controllerIndex,
+			"model":      helpers.FirstNonEmpty(controller.Model, controller.Name, "Unknown"),
+			"serial":     helpers.FirstNonEmpty(controller.SerialNumber, "Unknown"),
+			"fwversion":  helpers.FirstNonEmpty(controller.FirmwareVersion, "Unknown"),
+			"source":     "redfish",
+		}).Set(1)
+		m.metrics["controller_status"].With(prometheus.Labels{
+			"controller": controllerIndex,
+			"source":     "redfish",
+		}).Set(helpers.BoolToFloat(controller.Status.OK()))
+	}
+
+	for _, driveLink := range storage.Drives {
+		var drive redfish.Drive
+		if err := m.redfish.Get(driveLink.ID, &drive); err != nil {
+			log.Printf("Error reading Redfish drive %s: %v", driveLink.ID, err)
+			continue
+		}
+		driveIdentifier := "Drive " + drive.ID
+		if slot, ok := redfishDriveSlot(drive.ID); ok && inBand != nil && inBand.enclosures[slot] != "" {
+			driveIdentifier = "Drive /c" + controllerIndex + "/e" + inBand.enclosures[slot] + "/s" + slot
+		}
+		m.metrics["drive_status"].With(prometheus.Labels{
+			"controller": controllerIndex,
+			"drive":      driveIdentifier,
+			"model_name": helpers.FirstNonEmpty(drive.Model, "Unknown"),
+			"protocol":   helpers.FirstNonEmpty(drive.Protocol, "Unknown"),
+			"source":     "redfish",
+		}).Set(helpers.BoolToFloat(drive.Status.OK()))
+		m.metrics["drive_failure_predicted"].With(prometheus.Labels{
+			"controller": controllerIndex,
+			"drive":      driveIdentifier,
+			"source":     "redfish",
+		}).Set(helpers.BoolToFloat(drive.FailurePredicted))
+	}
+
+	if storage.Volumes.ID == "" {
+		return
+	}
+	volumes, err := m.redfish.Members(storage.Volumes.ID)
+	if err != nil {
+		log.Printf("Error listing Redfish volumes of %s: %v", storage.ID, err)
+		return
+	}
+	for _, volumeLink := range volumes {
+		var volume redfish.Volume
+		if err := m.redfish.Get(volumeLink.ID, &volume); err != nil {
+			log.Printf("Error reading Redfish volume %s: %v", volumeLink.ID, err)
+			continue
+		}
+		m.metrics["virtual_drive_status"].With(prometheus.Labels{
+			"controller": controllerIndex,
+			"vd":         volume.ID,
+			"source":     "redfish",
+		}).Set(helpers.BoolToFloat(volume.Status.OK()))
+	}
+}
+
+// exportRedfishChassis exports temperatures, fans, PSUs and power draw of a chassis
+func (m *Metrics) exportRedfishChassis(chassis redfish.Chassis) {
+	if chassis.Thermal.ID != "" {
+		var thermal redfish.Thermal
+		if err := m.redfish.Get(chassis.Thermal.ID, &thermal); err != nil {
+			log.Printf("Error reading Redfish thermal of %s: %v", chassis.ID, err)
+		} else {
+			for _, temp := range thermal.Temperatures {
+				if temp.ReadingCelsius != nil {
+					m.metrics["redfish_temperature_celsius"].With(prometheus.Labels{
+						"chassis": chassis.ID,
+						"sensor":  temp.Name,
+					}).Set(*temp.ReadingCelsius)
+				}
+			}
+			for _, fan := range thermal.Fans {
+				if fan.Reading != nil {
+					m.metrics["redfish_fan_reading"].With(prometheus.Labels{
+						"chassis": chassis.ID,
+						"fan":     fan.Name,
+						"unit":    helpers.FirstNonEmpty(fan.ReadingUnits, "Unknown"),
+					}).Set(*fan.Reading)
+				}
+				m.metrics["redfish_fan_health"].With(prometheus.Labels{
+					"chassis": chassis.ID,
+					"fan":     fan.Name,
+				}).Set(helpers.BoolToFloat(fan.Status.OK()))
+			}
+		}
+	}
+
+	if chassis.Power.ID != "" {
+		var power redfish.Power
+		if err := m.redfish.Get(chassis.Power.ID, &power); err != nil {
+			log.Printf("Error reading Redfish power of %s: %v", chassis.ID, err)
+			return
+		}
+		for _, control := range power.PowerControl {
+			if control.PowerConsumedWatts != nil {
+				m.metrics["redfish_power_consumed_watts"].With(prometheus.Labels{
+					"chassis": chassis.ID,
+					"name":    control.Name,
+				}).Set(*control.PowerConsumedWatts)
+			}
+		}
+		for _, psu := range power.PowerSupplies {
+			// Absent bays report State=Absent and no health
+			if psu.Status.State == "Absent" {
+				continue
+			}
+			m.metrics["redfish_psu_health"].With(prometheus.Labels{
+				"chassis": chassis.ID,
+				"psu":     psu.Name,
+			}).Set(helpers.BoolToFloat(psu.Status.OK()))
+		}
+		for _, voltage := range power.Voltages {
+			if voltage.ReadingVolts != nil {
+				m.metrics["redfish_voltage_volts"].With(prometheus.Labels{
+					"chassis": chassis.ID,
+					"sensor":  voltage.Name,
+				}).Set(*voltage.ReadingVolts)
+			}
+		}
+	}
+}
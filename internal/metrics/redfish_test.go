@@ -0,0 +1,127 @@
+package metrics
+
+import (
+	"context"
+	"esxi_exporter/internal/config"
+	"esxi_exporter/internal/executor"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// perccliShowBMC lists the controller behind the recorded iDRAC storage
+// resource, with the recorded drive in bay 0
+const perccliShowBMC = `{"Controllers": [
+	{"Command Status": {"Status": "Success"}, "Response Data": {
+		"Basics": {"Controller": "0", "Model": "PERC H730P Mini", "Serial Number": "5CG00Q1"},
+		"Version": {"Driver Name": "lsi-mr3"},
+		"Status": {"Controller Status": "Optimal"},
+		"PD LIST": [
+			{"EID:Slt": "32:0", "State": "Onln", "Intf": "SAS", "Model": "ST600MM0088"},
+			{"EID:Slt": "32:1", "State": "Onln", "Intf": "SAS", "Model": "ST600MM0088"}]}}
+]}`
+
+// mockBMC serves a system holding the storage and drive recorded in the
+// redfish package's testdata, and a chassis without sensors
+func mockBMC(t *testing.T) *httptest.Server {
+	bodies := map[string][]byte{
+		"/redfish/v1/Systems":                                                       []byte(`{"Members": [{"@odata.id": "/redfish/v1/Systems/System.Embedded.1"}]}`),
+		"/redfish/v1/Systems/System.Embedded.1":                                     []byte(`{"Id": "System.Embedded.1", "Storage": {"@odata.id": "/redfish/v1/Systems/System.Embedded.1/Storage"}}`),
+		"/redfish/v1/Systems/System.Embedded.1/Storage":                             []byte(`{"Members": [{"@odata.id": "/redfish/v1/Systems/System.Embedded.1/Storage/RAID.Integrated.1-1"}]}`),
+		"/redfish/v1/Systems/System.Embedded.1/Storage/RAID.Integrated.1-1/Volumes": []byte(`{"Members": []}`),
+		"/redfish/v1/Chassis":                                                       []byte(`{"Members": []}`),
+	}
+	for path, fixture := range map[string]string{
+		"/redfish/v1/Systems/System.Embedded.1/Storage/RAID.Integrated.1-1":                                          "storage.json",
+		"/redfish/v1/Systems/System.Embedded.1/Storage/Drives/Disk.Bay.0:Enclosure.Internal.0-1:RAID.Integrated.1-1": "drive.json",
+	} {
+		body, err := ioutil.ReadFile(filepath.Join("..", "redfish", "testdata", fixture))
+		if err != nil {
+			t.Fatal(err)
+		}
+		bodies[path] = body
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := bodies[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// perccliOnly answers `perccli /cALL show all J` with showAll and fails
+// every other command
+func perccliOnly(showAll string) executor.Executor {
+	return execFunc(func(ctx context.Context, command executor.Command) (string, error) {
+		if strings.HasSuffix(command.String(), "/perccli /cALL show all J") {
+			return showAll, nil
+		}
+		return "", fmt.Errorf("%s: not available", command)
+	})
+}
+
+func newRedfishRun(t *testing.T, exec executor.Executor) (*Metrics, func(family string) map[string]float64) {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Redfish = config.RedfishConfig{URL: mockBMC(t).URL}
+	pm, err := NewMetrics(cfg, exec, []string{"redfish"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	run, build := pm.newRun(context.Background())
+	return run, func(family string) map[string]float64 { return gauges(t, build, family) }
+}
+
+func TestCollectRedfishMatchesPerccli(t *testing.T) {
+	run, gathered := newRedfishRun(t, perccliOnly(perccliShowBMC))
+	if err := run.collectRedfish(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The drive warns of a predicted failure
+	for family, want := range map[string]map[string]float64{
+		"controller_status": {"controller=0,source=redfish": 1},
+		"drive_status": {
+			"controller=0,drive=Drive /c0/e32/s0,model_name=ST600MM0088,protocol=SAS,source=redfish": 0,
+		},
+		"drive_failure_predicted": {"controller=0,drive=Drive /c0/e32/s0,source=redfish": 1},
+	} {
+		if got := gathered(family); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, want %v", family, got, want)
+		}
+	}
+}
+
+// Drives perccli can't place keep the BMC's ID
+func TestCollectRedfishUnmatchedDrives(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		exec       executor.Executor
+		controller string
+	}{
+		{"no perccli", esxcliExecutor{}, "RAID.Integrated.1-1"},
+		{"another controller", perccliOnly(strings.Replace(perccliShowBMC, "5CG00Q1", "5CF0123", 1)), "RAID.Integrated.1-1"},
+		{"two enclosures", perccliOnly(strings.Replace(perccliShowBMC, `"32:1"`, `"64:0"`, 1)), "0"},
+	} {
+		run, gathered := newRedfishRun(t, tc.exec)
+		if err := run.collectRedfish(); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		want := map[string]float64{
+			"controller=" + tc.controller + ",drive=Drive Disk.Bay.0:Enclosure.Internal.0-1:RAID.Integrated.1-1,source=redfish": 1,
+		}
+		if got := gathered("drive_failure_predicted"); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, want %v", tc.name, got, want)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"context"
+	"esxi_exporter/internal/config"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// checkSchedules rejects schedules of unknown collectors
+func checkSchedules(cfg *config.Config) error {
+	for name, schedule := range cfg.Schedules {
+		found := false
+		for _, c := range collectors {
+			if c.name == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("schedule of unknown collector %q", name)
+		}
+		if schedule.Interval < 0 || schedule.Jitter < 0 {
+			return fmt.Errorf("schedule of collector %q is negative", name)
+		}
+	}
+	return nil
+}
+
+// schedule returns the interval and jitter of a collector, the defaults of
+// the collectors table unless overridden in the config file
+func schedule(cfg *config.Config, c collector) (time.Duration, time.Duration) {
+	interval, jitter := c.interval, c.jitter
+	if override, ok := cfg.Schedules[c.name]; ok {
+		if override.Interval > 0 {
+			interval = override.Interval
+		}
+		if override.Interval > 0 || override.Jitter > 0 {
+			jitter = override.Jitter
+		}
+	}
+	return interval, jitter
+}
+
+// Run runs each selected collector on its own schedule until ctx is done.
+// A collector runs right away the first time, then every interval plus a
+// random delay of up to jitter. Scrapes merge the latest snapshot of
+// every collector. Inventory completes its first run before the others
+// start so their first snapshots carry the host's FQDN.
+func (m *Metrics) Run(ctx context.Context) {
+	for {
+		m.mtx.Lock()
+		cfg, selected := m.config, m.collectors
+		m.mtx.Unlock()
+
+		for _, c := range selected {
+			if c.name == "inventory" && m.lastRun(c.name).IsZero() {
+				m.runCollector(ctx, c)
+			}
+		}
+
+		// Closing stop reschedules without cancelling runs in progress
+		stop := make(chan struct{})
+		var wg sync.WaitGroup
+		for _, c := range selected {
+			interval, jitter := schedule(cfg, c)
+			wg.Add(1)
+			go func(c collector) {
+				defer wg.Done()
+				m.runEvery(ctx, stop, c, interval, jitter)
+			}(c)
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-m.reschedule:
+		}
+		close(stop)
+		wg.Wait()
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// runEvery runs a collector on its schedule until ctx is done or stop is
+// closed. The first wait accounts for the last run so rescheduling doesn't
+// rerun collectors.
+func (m *Metrics) runEvery(ctx context.Context, stop <-chan struct{}, c collector, interval, jitter time.Duration) {
+	for {
+		var delay time.Duration
+		if last := m.lastRun(c.name); !last.IsZero() {
+			delay = time.Until(last.Add(interval))
+			if jitter > 0 {
+				delay += time.Duration(rand.Int63n(int64(jitter)))
+			}
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		m.runCollector(ctx, c)
+	}
+}
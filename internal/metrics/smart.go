@@ -0,0 +1,157 @@
+package metrics
+
+import (
+	"context"
+	"esxi_exporter/internal/helpers"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// smartJob reads the SMART attributes of one drive
+type smartJob struct {
+	controller string
+	drive      string
+	source     string
+	// read is bounded by the SMART timeout through ctx
+	read func(ctx context.Context) map[string]float64
+}
+
+// collectSmart exports SMART attributes of the physical drives, read
+// through perccli or, without a PERC controller, through esxcli
+func (m *Metrics) collectSmart() error {
+	jobs := []smartJob{}
+
+	controllers, err := m.perccliControllers()
+	if err == nil {
+		for _, response := range controllers {
+			if !isMegaraid(response) {
+				continue
+			}
+			controllerIndex := helpers.GetString(response["Basics"].(map[string]interface{}), "Controller", "Unknown")
+			pdList, _ := response["PD LIST"].([]interface{})
+			for _, drive := range pdList {
+				driveMap, ok := drive.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				enclosure, slot := driveSlot(driveMap)
+				drivePath := "/c" + controllerIndex + "/e" + enclosure + "/s" + slot
+				jobs = append(jobs, smartJob{
+					controller: controllerIndex,
+					drive:      "Drive " + drivePath,
+					source:     "perccli",
+					read: func(ctx context.Context) map[string]float64 {
+						return m.parseSmartData(m.getPerccliSmart(ctx, drivePath))
+					},
+				})
+			}
+		}
+	} else {
+		devices, err := m.runEsxcli("storage", "core", "device", "list")
+		if err != nil {
+			return err
+		}
+		for _, device := range m.discoverEsxcliDevices(devices) {
+			deviceID, displayName := device["id"], device["display_name"]
+			jobs = append(jobs, smartJob{
+				controller: "esxcli",
+				drive:      displayName,
+				source:     "smartctl",
+				read: func(ctx context.Context) map[string]float64 {
+					smartAttrs := m.parseEsxcliSmart(ctx, deviceID)
+					if len(smartAttrs) == 0 {
+						log.Printf("No SMART data collected via esxcli for device: %s (%s)", displayName, deviceID)
+					}
+					return smartAttrs
+				},
+			})
+		}
+	}
+
+	return m.runSmartJobs(jobs)
+}
+
+// runSmartJobs reads drives in parallel, at most Workers at once overall
+// and PerController at once on one controller, until the SMART timeout
+func (m *Metrics) runSmartJobs(jobs []smartJob) error {
+	workers, perController := m.config.Smart.Workers, m.config.Smart.PerController
+	if workers < 1 {
+		workers = 1
+	}
+	if perController < 1 {
+		perController = 1
+	}
+	ctx := m.ctx
+	if m.config.Smart.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.config.Smart.Timeout)
+		defer cancel()
+	}
+
+	byController := make(map[string][]smartJob)
+	order := []string{}
+	for _, job := range jobs {
+		if _, ok := byController[job.controller]; !ok {
+			order = append(order, job.controller)
+		}
+		byController[job.controller] = append(byController[job.controller], job)
+	}
+
+	// Each controller gets up to perController goroutines taking its drives
+	// in turn; a worker slot is held while a drive is read
+	slots := make(chan struct{}, workers)
+	var skipped int64
+	var wg sync.WaitGroup
+	for _, controller := range order {
+		queue := make(chan smartJob, len(byController[controller]))
+		for _, job := range byController[controller] {
+			queue <- job
+		}
+		close(queue)
+
+		for i := 0; i < perController && i < len(byController[controller]); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for job := range queue {
+					select {
+					case slots <- struct{}{}:
+					case <-ctx.Done():
+						atomic.AddInt64(&skipped, 1)
+						continue
+					}
+					if ctx.Err() != nil {
+						<-slots
+						atomic.AddInt64(&skipped, 1)
+						continue
+					}
+					attrs := job.read(ctx)
+					<-slots
+					if ctx.Err() != nil {
+						// The timeout killed the command; its output is partial at best
+						atomic.AddInt64(&skipped, 1)
+						continue
+					}
+					for attr, value := range attrs {
+						m.metrics["drive_smart"].With(prometheus.Labels{
+							"controller": job.controller,
+							"drive":      job.drive,
+							"attribute":  attr,
+							"source":     job.source,
+						}).Set(value)
+					}
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	if skipped > 0 {
+		return fmt.Errorf("SMART collection stopped with %d of %d drives unread: %v", skipped, len(jobs), ctx.Err())
+	}
+	return nil
+}
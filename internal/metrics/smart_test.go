@@ -0,0 +1,157 @@
+package metrics
+
+import (
+	"context"
+	"esxi_exporter/internal/config"
+	"esxi_exporter/internal/executor"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// perccliShowAll lists two MegaRAID controllers with one drive each
+const perccliShowAll = `{"Controllers": [
+	{"Command Status": {"Status": "Success"}, "Response Data": {
+		"Basics": {"Controller": "0", "Model": "PERC H730P Mini"},
+		"Version": {"Driver Name": "lsi-mr3"},
+		"Status": {"Controller Status": "Optimal"},
+		"PD LIST": [{"EID:Slt": "32:0", "State": "Onln", "Intf": "SAS", "Model": "ST600MM0009"}]}},
+	{"Command Status": {"Status": "Success"}, "Response Data": {
+		"Basics": {"Controller": "1", "Model": "PERC H330 Adapter"},
+		"Version": {"Driver Name": "lsi-mr3"},
+		"Status": {"Controller Status": "Optimal"},
+		"PD LIST": [{"EID:Slt": "8:0", "State": "Onln", "Intf": "SATA", "Model": "MZ7LH480"}]}}
+]}`
+
+// perccliShowOne lists one MegaRAID controller with two drives
+const perccliShowOne = `{"Controllers": [
+	{"Command Status": {"Status": "Success"}, "Response Data": {
+		"Basics": {"Controller": "0", "Model": "PERC H730P Mini"},
+		"Version": {"Driver Name": "lsi-mr3"},
+		"Status": {"Controller Status": "Optimal"},
+		"PD LIST": [
+			{"EID:Slt": "32:0", "State": "Onln", "Intf": "SAS", "Model": "ST600MM0009"},
+			{"EID:Slt": "32:1", "State": "Onln", "Intf": "SAS", "Model": "ST600MM0009"}]}}
+]}`
+
+// perccliSmart is `perccli /cX/eY/sZ show smart` output holding 7
+// reallocated sectors
+const perccliSmart = "Smart Data Info /c0/e32/s0 = \n01 00 05 33 00 64 64 07 00 00 00 00 00 00\n"
+
+// execFunc adapts a function to executor.Executor
+type execFunc func(ctx context.Context, command executor.Command) (string, error)
+
+func (f execFunc) Run(ctx context.Context, command executor.Command) (string, error) {
+	return f(ctx, command)
+}
+
+// blockingSmart answers `perccli /cALL show all J` with showAll, holding
+// every `show smart` until release is closed. Each read is announced on
+// started.
+func blockingSmart(showAll string, started chan<- string, release <-chan struct{}) executor.Executor {
+	return execFunc(func(ctx context.Context, command executor.Command) (string, error) {
+		args := strings.Join(command.Args[1:], " ")
+		switch {
+		case args == "/cALL show all J":
+			return showAll, nil
+		case strings.HasSuffix(args, " show smart"):
+			started <- command.Args[1]
+			select {
+			case <-release:
+				return perccliSmart, nil
+			case <-ctx.Done():
+				return "", ctx.Err()
+			}
+		}
+		return "", fmt.Errorf("%s: not available", command)
+	})
+}
+
+func newSmartMetrics(t *testing.T, exec executor.Executor, workers, perController int) *Metrics {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Smart = config.SmartConfig{Workers: workers, PerController: perController, Timeout: 10 * time.Second}
+	pm, err := NewMetrics(cfg, exec, []string{"storage", "smart"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pm
+}
+
+// A SMART pass holds no lock the storage collector needs, so controller
+// status keeps refreshing while drives are read
+func TestSmartReadsDontHoldUpStorage(t *testing.T) {
+	started := make(chan string, 2)
+	release := make(chan struct{})
+	pm := newSmartMetrics(t, blockingSmart(perccliShowAll, started, release), 1, 1)
+
+	smartDone := make(chan error, 1)
+	go func() {
+		run, _ := pm.newRun(context.Background())
+		smartDone <- run.collectSmart()
+	}()
+	<-started
+
+	storageDone := make(chan error, 1)
+	go func() {
+		run, _ := pm.newRun(context.Background())
+		storageDone <- run.collectStorage()
+	}()
+	select {
+	case err := <-storageDone:
+		if err != nil {
+			t.Errorf("storage: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("storage collection waited for the SMART read")
+	}
+
+	close(release)
+	if err := <-smartDone; err != nil {
+		t.Errorf("smart: %v", err)
+	}
+}
+
+func TestSmartConcurrencyLimits(t *testing.T) {
+	for _, tc := range []struct {
+		name                   string
+		showAll                string
+		workers, perController int
+		concurrent             bool
+	}{
+		{"two controllers", perccliShowAll, 2, 1, true},
+		{"one worker", perccliShowAll, 1, 2, false},
+		{"one controller", perccliShowOne, 2, 2, true},
+		{"one per controller", perccliShowOne, 2, 1, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			started := make(chan string, 2)
+			release := make(chan struct{})
+			pm := newSmartMetrics(t, blockingSmart(tc.showAll, started, release), tc.workers, tc.perController)
+			run, build := pm.newRun(context.Background())
+			done := make(chan error, 1)
+			go func() { done <- run.collectSmart() }()
+
+			first := <-started
+			select {
+			case second := <-started:
+				if !tc.concurrent {
+					t.Errorf("%s was read while %s was", second, first)
+				}
+			case <-time.After(200 * time.Millisecond):
+				if tc.concurrent {
+					t.Errorf("only %s was read at once", first)
+				}
+			}
+			close(release)
+			if err := <-done; err != nil {
+				t.Fatal(err)
+			}
+
+			if counts := samples(t, build); counts["drive_smart"] != 2 {
+				t.Errorf("got %d drive_smart samples, want 2", counts["drive_smart"])
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package metrics
+
+import (
+	"context"
+	"esxi_exporter/internal/helpers"
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// snapshot is the immutable result of a completed collector run
+type snapshot struct {
+	families []*dto.MetricFamily
+	taken    time.Time
+}
+
+// Gather implements prometheus.Gatherer. The families are shared between
+// scrapes and must not be modified.
+func (s *snapshot) Gather() ([]*dto.MetricFamily, error) {
+	return s.families, nil
+}
+
+// newRun returns a Metrics sharing m's configuration that collects into
+// fresh vectors, so concurrent runs and scrapes never see each other's
+// partial results
+func (m *Metrics) newRun(ctx context.Context) (*Metrics, *prometheus.Registry) {
+	m.mtx.Lock()
+	run := &Metrics{
+		ctx:       ctx,
+		namespace: m.namespace,
+		host:      m.host,
+		config:    m.config,
+		executor:  m.executor,
+		vcenter:   m.vcenter,
+		wbem:      m.wbem,
+		redfish:   m.redfish,
+		perccli:   m.perccli,
+	}
+	m.mtx.Unlock()
+	return run, run.newBuild()
+}
+
+// newBuild points m.metrics and m.counters at empty vectors and returns
+// the registry gathering them
+func (m *Metrics) newBuild() *prometheus.Registry {
+	build := prometheus.NewRegistry()
+	m.metrics = make(map[string]*prometheus.GaugeVec, len(metricDefs))
+	m.counters = make(map[string]*counterVec, len(counterDefs))
+
+	for _, def := range metricDefs {
+		m.metrics[def.name] = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: m.namespace,
+				Name:      def.name,
+				Help:      def.help,
+			},
+			def.labels,
+		)
+		build.MustRegister(m.metrics[def.name])
+	}
+	for _, def := range counterDefs {
+		m.counters[def.name] = newCounterVec(m.namespace, def.name, def.help, def.labels)
+		build.MustRegister(m.counters[def.name])
+	}
+	return build
+}
+
+// runCollector runs a collector and publishes its results as the
+// collector's snapshot. The previous snapshot is served until then, and
+// kept when ctx is cancelled during the run, in which case it returns false.
+func (m *Metrics) runCollector(ctx context.Context, c collector) bool {
+	run, build := m.newRun(ctx)
+	host := run.host
+
+	start := time.Now()
+	err := c.collect(run)
+	duration := time.Since(start)
+	if err != nil {
+		log.Printf("Error running %s collector: %v", c.name, err)
+	}
+
+	labels := prometheus.Labels{"collector": c.name}
+	run.metrics["collector_success"].With(labels).Set(helpers.BoolToFloat(err == nil))
+	run.metrics["collector_duration_seconds"].With(labels).Set(duration.Seconds())
+
+	// The inventory collector resolves the host FQDN for later runs
+	if run.host != host {
+		m.SetHost(run.host)
+	}
+
+	if ctx.Err() != nil {
+		log.Printf("Collection cancelled, keeping the previous %s snapshot", c.name)
+		return false
+	}
+
+	families, gatherErr := build.Gather()
+	if gatherErr != nil {
+		log.Printf("Error gathering %s metrics, keeping the previous snapshot: %v", c.name, gatherErr)
+	} else {
+		m.publish(c.name, families, start)
+	}
+	m.setStatus(c.name, start, duration, err)
+	return true
+}
+
+// publishFailure replaces the snapshot of a collector that didn't complete
+// with its collector_success and collector_duration_seconds alone
+func (m *Metrics) publishFailure(name string, start time.Time, err error) {
+	log.Printf("Error running %s collector: %v", name, err)
+	run, build := m.newRun(context.Background())
+	duration := time.Since(start)
+	labels := prometheus.Labels{"collector": name}
+	run.metrics["collector_success"].With(labels).Set(0)
+	run.metrics["collector_duration_seconds"].With(labels).Set(duration.Seconds())
+
+	families, gatherErr := build.Gather()
+	if gatherErr != nil {
+		log.Printf("Error gathering %s metrics, keeping the previous snapshot: %v", name, gatherErr)
+		return
+	}
+	m.publish(name, families, start)
+	m.setStatus(name, start, duration, err)
+}
+
+// publish replaces the snapshot of a collector unless it was deselected
+// while running
+func (m *Metrics) publish(name string, families []*dto.MetricFamily, taken time.Time) {
+	if !m.selected(name) {
+		return
+	}
+	m.snapshotMtx.Lock()
+	defer m.snapshotMtx.Unlock()
+	m.snapshots[name] = &snapshot{families: families, taken: taken}
+}
+
+// selected reports whether the named collector is currently selected
+func (m *Metrics) selected(name string) bool {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	for _, c := range m.collectors {
+		if c.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// snapshotGatherer merges the snapshots of every collector
+type snapshotGatherer struct {
+	m *Metrics
+}
+
+// Gather implements prometheus.Gatherer
+func (g snapshotGatherer) Gather() ([]*dto.MetricFamily, error) {
+	g.m.snapshotMtx.RLock()
+	gatherers := make(prometheus.Gatherers, 0, len(g.m.snapshots))
+	for _, c := range collectors {
+		if s, ok := g.m.snapshots[c.name]; ok {
+			gatherers = append(gatherers, s)
+		}
+	}
+	g.m.snapshotMtx.RUnlock()
+	return gatherers.Gather()
+}
+
+// freshnessCollector exports the age of each collector's snapshot at scrape time
+type freshnessCollector struct {
+	m         *Metrics
+	timestamp *prometheus.Desc
+	stale     *prometheus.Desc
+}
+
+func newFreshnessCollector(m *Metrics) *freshnessCollector {
+	return &freshnessCollector{
+		m: m,
+		timestamp: prometheus.NewDesc(prometheus.BuildFQName(m.namespace, "", "last_collection_timestamp_seconds"),
+			"Unix time the served metrics of the collector were collected at", []string{"collector"}, nil),
+		stale: prometheus.NewDesc(prometheus.BuildFQName(m.namespace, "", "metrics_stale"),
+			"Whether the served metrics of the collector are older than stale_after (1=Stale, 0=Fresh)", []string{"collector"}, nil),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *freshnessCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.timestamp
+	ch <- c.stale
+}
+
+// Collect implements prometheus.Collector
+func (c *freshnessCollector) Collect(ch chan<- prometheus.Metric) {
+	c.m.snapshotMtx.RLock()
+	defer c.m.snapshotMtx.RUnlock()
+
+	for name, s := range c.m.snapshots {
+		stale := c.m.staleAfter > 0 && time.Since(s.taken) > c.m.staleAfter
+		ch <- prometheus.MustNewConstMetric(c.timestamp, prometheus.GaugeValue, float64(s.taken.UnixNano())/1e9, name)
+		ch <- prometheus.MustNewConstMetric(c.stale, prometheus.GaugeValue, helpers.BoolToFloat(stale), name)
+	}
+}
@@ -0,0 +1,150 @@
+package metrics
+
+import (
+	"esxi_exporter/internal/config"
+	"esxi_exporter/internal/redfish"
+	"esxi_exporter/internal/vcenter"
+	"esxi_exporter/internal/wbem"
+	"reflect"
+	"time"
+)
+
+// CollectorStatus is the outcome of the last run of a collector
+type CollectorStatus struct {
+	Name     string
+	LastRun  time.Time
+	Duration time.Duration
+	Err      string
+}
+
+// setConfig switches to cfg and the selected collectors. The status and
+// snapshots of collectors that are no longer selected are dropped.
+func (m *Metrics) setConfig(cfg *config.Config, selected []collector) {
+	m.mtx.Lock()
+	old := m.config
+	m.config = cfg
+	m.collectors = selected
+	// API clients keep their sessions across runs, and across reloads that
+	// leave their section unchanged
+	if m.vcenter == nil || !reflect.DeepEqual(cfg.Vcenter, old.Vcenter) {
+		m.vcenter = nil
+		if cfg.Vcenter.URL != "" {
+			m.vcenter = vcenter.NewClient(cfg.Vcenter)
+		}
+	}
+	if m.wbem == nil || !reflect.DeepEqual(cfg.Wbem, old.Wbem) {
+		m.wbem = nil
+		if cfg.Wbem.URL != "" {
+			m.wbem = wbem.NewClient(cfg.Wbem)
+		}
+	}
+	if m.redfish == nil || !reflect.DeepEqual(cfg.Redfish, old.Redfish) {
+		m.redfish = nil
+		if cfg.Redfish.URL != "" {
+			m.redfish = redfish.NewClient(cfg.Redfish)
+		}
+	}
+	m.mtx.Unlock()
+
+	wanted := make(map[string]bool, len(selected))
+	for _, c := range selected {
+		wanted[c.name] = true
+	}
+
+	m.statusMtx.Lock()
+	for name := range m.status {
+		if !wanted[name] {
+			delete(m.status, name)
+		}
+	}
+	for _, c := range selected {
+		if _, ok := m.status[c.name]; !ok {
+			m.status[c.name] = CollectorStatus{Name: c.name}
+		}
+	}
+	m.statusMtx.Unlock()
+
+	m.snapshotMtx.Lock()
+	for name := range m.snapshots {
+		if !wanted[name] {
+			delete(m.snapshots, name)
+		}
+	}
+	m.staleAfter = cfg.StaleAfter
+	m.snapshotMtx.Unlock()
+}
+
+// setStatus records the outcome of a collector run. The exporter is ready
+// once every selected collector has run.
+func (m *Metrics) setStatus(name string, start time.Time, duration time.Duration, err error) {
+	s := CollectorStatus{Name: name, LastRun: start, Duration: duration}
+	if err != nil {
+		s.Err = err.Error()
+	}
+
+	m.statusMtx.Lock()
+	defer m.statusMtx.Unlock()
+	if _, ok := m.status[name]; !ok {
+		return
+	}
+	m.status[name] = s
+
+	if !m.ready {
+		m.ready = true
+		for _, s := range m.status {
+			if s.LastRun.IsZero() {
+				m.ready = false
+			}
+		}
+	}
+}
+
+// lastRun returns when the named collector last started
+func (m *Metrics) lastRun(name string) time.Time {
+	m.statusMtx.Lock()
+	defer m.statusMtx.Unlock()
+	return m.status[name].LastRun
+}
+
+// Status returns the status of the selected collectors in the order they run
+func (m *Metrics) Status() []CollectorStatus {
+	m.statusMtx.Lock()
+	defer m.statusMtx.Unlock()
+
+	status := make([]CollectorStatus, 0, len(m.status))
+	for _, c := range collectors {
+		if s, ok := m.status[c.name]; ok {
+			status = append(status, s)
+		}
+	}
+	return status
+}
+
+// Ready reports whether every collector has completed a first run
+func (m *Metrics) Ready() bool {
+	m.statusMtx.Lock()
+	defer m.statusMtx.Unlock()
+	return m.ready
+}
+
+// ApplyConfig switches to a new configuration and collector selection.
+// Runs in progress complete with the previous configuration and the
+// metrics of collectors that stay selected are kept.
+func (m *Metrics) ApplyConfig(cfg *config.Config, names []string) error {
+	selected, err := selectCollectors(cfg, names)
+	if err != nil {
+		return err
+	}
+	if err := checkSchedules(cfg); err != nil {
+		return err
+	}
+
+	m.setConfig(cfg, selected)
+
+	// Have Run pick up the new selection and schedules
+	select {
+	case m.reschedule <- struct{}{}:
+	default:
+	}
+	return nil
+}
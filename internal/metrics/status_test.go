@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"esxi_exporter/internal/config"
+	"testing"
+)
+
+// Reloads keep the API clients, and with them their sessions, unless their
+// section changed
+func TestApplyConfigKeepsClients(t *testing.T) {
+	cfg := config.Default()
+	cfg.Vcenter = config.VcenterConfig{URL: "https://vcenter.example.com", Username: "monitoring", Password: "secret"}
+	cfg.Wbem = config.WbemConfig{URL: "https://localhost:5989", Username: "root", Password: "secret"}
+	cfg.Redfish = config.RedfishConfig{URL: "https://idrac-esx01.example.com", Username: "monitoring", Password: "secret"}
+	pm, err := NewMetrics(cfg, esxcliExecutor{}, []string{"vcenter", "wbem", "redfish"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vcenterClient, wbemClient := pm.vcenter, pm.wbem
+
+	reloaded := *cfg
+	reloaded.Wbem.Password = "rotated"
+	reloaded.Redfish = config.RedfishConfig{}
+	if err := pm.ApplyConfig(&reloaded, []string{"vcenter", "wbem"}); err != nil {
+		t.Fatal(err)
+	}
+	if pm.vcenter != vcenterClient {
+		t.Error("replaced the vcenter client of an unchanged section")
+	}
+	if pm.wbem == wbemClient || pm.wbem == nil {
+		t.Error("kept the wbem client of a changed section")
+	}
+	if pm.redfish != nil {
+		t.Error("kept the redfish client of a removed section")
+	}
+
+	reloaded.Redfish = cfg.Redfish
+	if err := pm.ApplyConfig(&reloaded, []string{"vcenter", "wbem", "redfish"}); err != nil {
+		t.Fatal(err)
+	}
+	if pm.redfish == nil {
+		t.Error("no redfish client for a restored section")
+	}
+}
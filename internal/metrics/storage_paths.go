@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// pathStates are the path states reported by esxcli storage core path list
+var pathStates = []string{"active", "standby", "disabled", "dead"}
+
+// collectStoragePaths exports per-device path counts, NMP policies and adapter
+// link state. A failed esxcli call doesn't stop the others; their errors are
+// returned together.
+func (m *Metrics) collectStoragePaths() error {
+	var errs []error
+	paths, err := m.runEsxcli("storage", "core", "path", "list")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	pathCounts := make(map[string]map[string]float64)
+	for _, path := range paths {
+		deviceID := path.Get("Device", "")
+		if deviceID == "" {
+			continue
+		}
+		if _, ok := pathCounts[deviceID]; !ok {
+			pathCounts[deviceID] = make(map[string]float64)
+			for _, state := range pathStates {
+				pathCounts[deviceID][state] = 0
+			}
+		}
+		state := strings.ToLower(path.Get("State", "unknown"))
+		pathCounts[deviceID][state]++
+	}
+
+	for deviceID, counts := range pathCounts {
+		for state, count := range counts {
+			m.metrics["storage_device_paths"].With(prometheus.Labels{
+				"device_id": deviceID,
+				"state":     state,
+			}).Set(count)
+		}
+	}
+
+	nmpDevices, err := m.runEsxcli("storage", "nmp", "device", "list")
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for _, device := range nmpDevices {
+		deviceID := device.Get("Device", "")
+		if deviceID == "" {
+			continue
+		}
+		m.metrics["storage_device_multipath_info"].With(prometheus.Labels{
+			"device_id":          deviceID,
+			"path_policy":        device.Get("PathSelectionPolicy", "Unknown"),
+			"storage_array_type": device.Get("StorageArrayType", "Unknown"),
+		}).Set(1)
+	}
+
+	adapters, err := m.runEsxcli("storage", "core", "adapter", "list")
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for _, adapter := range adapters {
+		name := adapter.Get("HBAName", "")
+		if name == "" {
+			continue
+		}
+		linkState := adapter.Get("LinkState", "Unknown")
+		m.metrics["storage_adapter_info"].With(prometheus.Labels{
+			"adapter":     name,
+			"driver":      adapter.Get("Driver", "Unknown"),
+			"link_state":  linkState,
+			"description": adapter.Get("Description", "Unknown"),
+		}).Set(1)
+
+		// Local and software adapters report link-n/a and have no link to lose
+		switch strings.ToLower(linkState) {
+		case "link-up", "online":
+			m.metrics["storage_adapter_link_up"].With(prometheus.Labels{"adapter": name}).Set(1)
+		case "link-down", "offline":
+			m.metrics["storage_adapter_link_up"].With(prometheus.Labels{"adapter": name}).Set(0)
+		}
+	}
+
+	return joinErrors(errs)
+}
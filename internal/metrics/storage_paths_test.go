@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"context"
+	"esxi_exporter/internal/config"
+	"esxi_exporter/internal/executor"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// esxcliExecutor answers esxcli commands, keyed by their namespace and
+// command ("storage core path list"), and fails every other command
+type esxcliExecutor map[string]string
+
+func (e esxcliExecutor) Run(ctx context.Context, command executor.Command) (string, error) {
+	if output, ok := e[strings.TrimPrefix(command.String(), "esxcli --formatter=xml ")]; ok {
+		return output, nil
+	}
+	return "", fmt.Errorf("%s: not available", command)
+}
+
+// newTestRun returns a run of collector name against exec and the registry
+// gathering what it exports
+func newTestRun(t *testing.T, exec executor.Executor, name string) (*Metrics, *prometheus.Registry) {
+	t.Helper()
+	pm, err := NewMetrics(config.Default(), exec, []string{name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pm.newRun(context.Background())
+}
+
+// samples counts the samples of each family gathered from build
+func samples(t *testing.T, build *prometheus.Registry) map[string]int {
+	t.Helper()
+	families, err := build.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := make(map[string]int)
+	for _, family := range families {
+		counts[strings.TrimPrefix(family.GetName(), Namespace+"_")] = len(family.GetMetric())
+	}
+	return counts
+}
+
+// gauges returns the samples of one family gathered from build, keyed by
+// their labels formatted as name=value pairs sorted by name
+func gauges(t *testing.T, build prometheus.Gatherer, family string) map[string]float64 {
+	t.Helper()
+	families, err := build.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[string]float64)
+	for _, f := range families {
+		if f.GetName() != Namespace+"_"+family {
+			continue
+		}
+		for _, metric := range f.GetMetric() {
+			pairs := make([]string, len(metric.GetLabel()))
+			for i, label := range metric.GetLabel() {
+				pairs[i] = label.GetName() + "=" + label.GetValue()
+			}
+			values[strings.Join(pairs, ",")] = metric.GetGauge().GetValue()
+		}
+	}
+	return values
+}
+
+func TestCollectStoragePathsWithoutNmp(t *testing.T) {
+	run, build := newTestRun(t, esxcliExecutor{
+		"storage core path list": `[
+			{"Device": "naa.600508b1001c4d41", "State": "active"},
+			{"Device": "naa.600508b1001c4d41", "State": "dead"}
+		]`,
+		"storage core adapter list": `[
+			{"HBAName": "vmhba0", "Driver": "lsi_mr3", "LinkState": "link-n/a", "Description": "PERC H730P Mini"},
+			{"HBAName": "vmhba64", "Driver": "qlnativefc", "LinkState": "link-up", "Description": "QLogic FC HBA"}
+		]`,
+	}, "storage_paths")
+
+	err := run.collectStoragePaths()
+	if err == nil || !strings.Contains(err.Error(), "storage nmp device list") {
+		t.Errorf("got error %v, want the nmp device list failure", err)
+	}
+
+	counts := samples(t, build)
+	for family, want := range map[string]int{
+		"storage_device_paths":          len(pathStates),
+		"storage_device_multipath_info": 0,
+		"storage_adapter_info":          2,
+		"storage_adapter_link_up":       1,
+	} {
+		if counts[family] != want {
+			t.Errorf("got %d %s samples, want %d", counts[family], family, want)
+		}
+	}
+}
+
+func TestCollectStoragePathsCombinesErrors(t *testing.T) {
+	run, _ := newTestRun(t, esxcliExecutor{}, "storage_paths")
+	err := run.collectStoragePaths()
+	if err == nil {
+		t.Fatal("got no error")
+	}
+	for _, command := range []string{"storage core path list", "storage nmp device list", "storage core adapter list"} {
+		if !strings.Contains(err.Error(), command) {
+			t.Errorf("error %q doesn't mention %s", err, command)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"esxi_exporter/internal/helpers"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// collectVcenter exports host, VM, datastore and alarm state from the configured vCenter
+func (m *Metrics) collectVcenter() error {
+	if m.config.Vcenter.URL == "" {
+		return fmt.Errorf("vcenter url is not configured")
+	}
+
+	hosts, err := m.vcenter.Hosts()
+	if err != nil {
+		return err
+	}
+	// names resolves managed object IDs (host-10, vm-42, ...) for alarm labels
+	names := make(map[string]string)
+	for _, host := range hosts {
+		names[host.Host] = host.Name
+		labels := prometheus.Labels{"host": host.Name}
+		m.metrics["vcenter_host_connected"].With(labels).Set(helpers.BoolToFloat(host.ConnectionState == "CONNECTED"))
+		m.metrics["vcenter_host_powered_on"].With(labels).Set(helpers.BoolToFloat(host.PowerState == "POWERED_ON"))
+
+		vms, err := m.vcenter.VMs(host.Host)
+		if err != nil {
+			log.Printf("Error listing VMs on %s: %v", host.Name, err)
+			continue
+		}
+		for _, vm := range vms {
+			names[vm.VM] = vm.Name
+			m.metrics["vcenter_vm_powered_on"].With(prometheus.Labels{
+				"host": host.Name,
+				"vm":   vm.Name,
+			}).Set(helpers.BoolToFloat(vm.PowerState == "POWERED_ON"))
+		}
+	}
+
+	datastores, err := m.vcenter.Datastores()
+	if err != nil {
+		return err
+	}
+	for _, datastore := range datastores {
+		names[datastore.Datastore] = datastore.Name
+		labels := prometheus.Labels{"datastore": datastore.Name, "type": datastore.Type}
+		m.metrics["vcenter_datastore_capacity_bytes"].With(labels).Set(float64(datastore.Capacity))
+		m.metrics["vcenter_datastore_free_bytes"].With(labels).Set(float64(datastore.FreeSpace))
+	}
+
+	alarms, err := m.vcenter.TriggeredAlarms()
+	if err != nil {
+		return err
+	}
+	alarmNames := make(map[string]string)
+	for _, alarm := range alarms {
+		alarmName, ok := alarmNames[alarm.Alarm.Value]
+		if !ok {
+			alarmName, err = m.vcenter.AlarmName(alarm.Alarm.Value)
+			if err != nil {
+				log.Printf("Error resolving alarm %s: %v", alarm.Alarm.Value, err)
+				alarmName = alarm.Alarm.Value
+			}
+			alarmNames[alarm.Alarm.Value] = alarmName
+		}
+		entity, ok := names[alarm.Entity.Value]
+		if !ok {
+			entity = alarm.Entity.Value
+		}
+		m.metrics["vcenter_alarm_triggered"].With(prometheus.Labels{
+			"entity_type":  alarm.Entity.Type,
+			"entity":       entity,
+			"alarm":        alarmName,
+			"status":       alarm.OverallStatus,
+			"acknowledged": strconv.FormatBool(alarm.Acknowledged),
+		}).Set(1)
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package metrics
+
+import (
+	"context"
+	"esxi_exporter/internal/config"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeVcenter answers logins and each request URI with its response. Other
+// requests get a 404.
+func fakeVcenter(t *testing.T, responses map[string]string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/session":
+			w.Write([]byte(`"session-1"`))
+			return
+		case strings.HasSuffix(r.URL.Path, "/SessionManager/SessionManager/Login"):
+			w.Header().Set("vmware-api-session-id", "vim-1")
+			w.Write([]byte(`{"_typeName":"UserSession","userName":"monitoring"}`))
+			return
+		}
+		response, ok := responses[r.URL.RequestURI()]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(response))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newVcenterRun(t *testing.T, responses map[string]string) (*Metrics, func(family string) map[string]float64) {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Vcenter = config.VcenterConfig{
+		URL:        fakeVcenter(t, responses).URL,
+		Username:   "monitoring",
+		Password:   "secret",
+		VimRelease: "8.0.1.0",
+	}
+	pm, err := NewMetrics(cfg, esxcliExecutor{}, []string{"vcenter"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	run, build := pm.newRun(context.Background())
+	return run, func(family string) map[string]float64 { return gauges(t, build, family) }
+}
+
+// vcenterResponses is an inventory of two hosts, one of them not
+// responding, with a VM, a vSAN datastore and an alarm on the second host
+var vcenterResponses = map[string]string{
+	"/api/vcenter/host": `[
+		{"host": "host-10", "name": "esx01.example.com", "connection_state": "CONNECTED", "power_state": "POWERED_ON"},
+		{"host": "host-12", "name": "esx02.example.com", "connection_state": "NOT_RESPONDING", "power_state": "POWERED_OFF"}]`,
+	"/api/vcenter/vm?hosts=host-10": `[
+		{"vm": "vm-101", "name": "web01", "power_state": "POWERED_ON"},
+		{"vm": "vm-102", "name": "db01", "power_state": "POWERED_OFF"}]`,
+	"/api/vcenter/vm?hosts=host-12": `[]`,
+	"/api/vcenter/datastore": `[
+		{"datastore": "datastore-15", "name": "vsanDatastore", "type": "VSAN", "free_space": 5497558138880, "capacity": 8796093022208}]`,
+	"/sdk/vim25/8.0.1.0/Folder/group-d1/triggeredAlarmState": `[
+		{"_typeName": "AlarmState", "key": "alarm-7.host-12", "overallStatus": "red", "acknowledged": false,
+		 "entity": {"_typeName": "ManagedObjectReference", "type": "HostSystem", "value": "host-12"},
+		 "alarm": {"_typeName": "ManagedObjectReference", "type": "Alarm", "value": "alarm-7"}},
+		{"_typeName": "AlarmState", "key": "alarm-9.vm-102", "overallStatus": "yellow", "acknowledged": true,
+		 "entity": {"_typeName": "ManagedObjectReference", "type": "VirtualMachine", "value": "vm-102"},
+		 "alarm": {"_typeName": "ManagedObjectReference", "type": "Alarm", "value": "alarm-9"}}]`,
+	"/sdk/vim25/8.0.1.0/Alarm/alarm-7/info": `{"_typeName": "AlarmInfo", "name": "Host connection and power state", "key": "alarm-7"}`,
+}
+
+func TestCollectVcenter(t *testing.T) {
+	run, gathered := newVcenterRun(t, vcenterResponses)
+	if err := run.collectVcenter(); err != nil {
+		t.Fatal(err)
+	}
+
+	// alarm-9 has no info and is labelled with its ID
+	for family, want := range map[string]map[string]float64{
+		"vcenter_host_connected": {
+			"host=esx01.example.com": 1,
+			"host=esx02.example.com": 0,
+		},
+		"vcenter_host_powered_on": {
+			"host=esx01.example.com": 1,
+			"host=esx02.example.com": 0,
+		},
+		"vcenter_vm_powered_on": {
+			"host=esx01.example.com,vm=web01": 1,
+			"host=esx01.example.com,vm=db01":  0,
+		},
+		"vcenter_datastore_capacity_bytes": {"datastore=vsanDatastore,type=VSAN": 8796093022208},
+		"vcenter_datastore_free_bytes":     {"datastore=vsanDatastore,type=VSAN": 5497558138880},
+		"vcenter_alarm_triggered": {
+			"acknowledged=false,alarm=Host connection and power state,entity=esx02.example.com,entity_type=HostSystem,status=red": 1,
+			"acknowledged=true,alarm=alarm-9,entity=db01,entity_type=VirtualMachine,status=yellow":                                1,
+		},
+	} {
+		if got := gathered(family); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, want %v", family, got, want)
+		}
+	}
+}
+
+func TestCollectVcenterWithoutDatastores(t *testing.T) {
+	responses := make(map[string]string)
+	for uri, response := range vcenterResponses {
+		if uri != "/api/vcenter/datastore" {
+			responses[uri] = response
+		}
+	}
+	run, gathered := newVcenterRun(t, responses)
+	if err := run.collectVcenter(); err == nil {
+		t.Error("got no error for the missing datastores")
+	}
+	if got := gathered("vcenter_host_connected"); len(got) != 2 {
+		t.Errorf("got host samples %v, want both hosts", got)
+	}
+}
@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// vmLine matches a vim-cmd vmsvc/getallvms row:
+// Vmid  Name  [datastore] path/vm.vmx  guestOS  vmx-NN  Annotation
+var vmLine = regexp.MustCompile(`^(\d+)\s+(.*?)\s+\[(.+?)\]\s+(.+?\.vmx)\s+(\S+)\s+(vmx-\d+)`)
+
+// collectVMs exports registered VMs with their datastore and power state
+func (m *Metrics) collectVMs() error {
+	output, err := m.runCmd("", "vim-cmd", "vmsvc/getallvms")
+	if err != nil {
+		return err
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		match := vmLine.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil {
+			continue
+		}
+		vmid := match[1]
+
+		m.metrics["vm_info"].With(prometheus.Labels{
+			"vmid":       vmid,
+			"name":       match[2],
+			"datastore":  match[3],
+			"guest_os":   match[5],
+			"hw_version": match[6],
+		}).Set(1)
+
+		state, err := m.runCmd("", "vim-cmd", "vmsvc/power.getstate", vmid)
+		if err != nil {
+			log.Printf("Error getting power state for VM %s: %v", vmid, err)
+			continue
+		}
+		m.metrics["vm_powered_on"].With(prometheus.Labels{"vmid": vmid}).Set(poweredOn(state))
+	}
+
+	return nil
+}
+
+// poweredOn maps vim-cmd power.getstate output to 1 for "Powered on"
+func poweredOn(output string) float64 {
+	for _, line := range strings.Split(output, "\n") {
+		if strings.EqualFold(strings.TrimSpace(line), "Powered on") {
+			return 1
+		}
+	}
+	return 0
+}
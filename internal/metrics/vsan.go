@@ -0,0 +1,123 @@
+package metrics
+
+import (
+	"esxi_exporter/internal/esxcli"
+	"esxi_exporter/internal/helpers"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// normalizeRecord rekeys a record with normalizeField so fields can be looked
+// up regardless of how a given ESXi release spells them
+func normalizeRecord(record esxcli.Record) esxcli.Record {
+	normalized := make(esxcli.Record, len(record))
+	for key, value := range record {
+		normalized[normalizeField(key)] = value
+	}
+	return normalized
+}
+
+// leadingNumber parses values such as "1200240377856 bytes" or "42%"
+func leadingNumber(value string) (float64, bool) {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(strings.TrimSuffix(fields[0], "%"), 64)
+	if err != nil {
+		return 0, false
+	}
+	return f, true
+}
+
+// healthyVsanState reports whether a vSAN health value is green
+func healthyVsanState(state string) bool {
+	state = strings.ToLower(strings.TrimSpace(state))
+	return state == "green" || state == "healthy" || strings.HasPrefix(state, "green ")
+}
+
+// collectVsan exports vSAN disk membership, disk health and cluster health
+// checks. vsan_disk_info carries the drive label the smartctl drive
+// families use, so per-disk vSAN health joins with drive state. A failed
+// esxcli call doesn't stop the others; their errors are returned together.
+func (m *Metrics) collectVsan() error {
+	var errs []error
+	disks, err := m.runEsxcli("vsan", "storage", "list")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	for _, disk := range disks {
+		deviceID := disk.Get("Device", "")
+		if deviceID == "" {
+			continue
+		}
+		disk = normalizeRecord(disk)
+		role := "cache"
+		if disk.Bool("iscapacitytier") {
+			role = "capacity"
+		}
+		m.metrics["vsan_disk_info"].With(prometheus.Labels{
+			"device_id":       deviceID,
+			"drive":           displayNameSuffix.ReplaceAllString(disk.Get("displayname", ""), ""),
+			"vsan_uuid":       disk.Get("vsanuuid", "Unknown"),
+			"disk_group_uuid": disk.Get("vsandiskgroupuuid", "Unknown"),
+			"role":            role,
+		}).Set(1)
+		m.metrics["vsan_disk_in_cmmds"].With(prometheus.Labels{"device_id": deviceID}).Set(helpers.BoolToFloat(disk.Bool("incmmds")))
+	}
+
+	debugDisks, err := m.runEsxcli("vsan", "debug", "disk", "list")
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for _, disk := range debugDisks {
+		disk = normalizeRecord(disk)
+		deviceID := disk.Get("name", "")
+		if deviceID == "" {
+			continue
+		}
+		labels := prometheus.Labels{"device_id": deviceID}
+
+		for check, key := range map[string]string{
+			"metadata":    "metadatahealth",
+			"operational": "operationalhealth",
+			"congestion":  "congestionhealth.state",
+			"space":       "spacehealth",
+		} {
+			if state, ok := disk[key]; ok {
+				m.metrics["vsan_disk_health"].With(prometheus.Labels{
+					"device_id": deviceID,
+					"check":     check,
+				}).Set(helpers.BoolToFloat(healthyVsanState(state)))
+			}
+		}
+		if congestion, ok := leadingNumber(disk.Get("congestionhealth.congestionvalue", "")); ok {
+			m.metrics["vsan_disk_congestion"].With(labels).Set(congestion)
+		}
+		if total, ok := leadingNumber(disk.Get("totalcapacity", "")); ok {
+			m.metrics["vsan_disk_capacity_bytes"].With(labels).Set(total)
+		}
+		if used, ok := leadingNumber(disk.Get("usedcapacity", "")); ok {
+			m.metrics["vsan_disk_used_bytes"].With(labels).Set(used)
+		}
+	}
+
+	checks, err := m.runEsxcli("vsan", "health", "cluster", "list")
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for _, check := range checks {
+		check = normalizeRecord(check)
+		name := check.First("", "healthtest", "name")
+		if name == "" {
+			continue
+		}
+		m.metrics["vsan_health_check"].With(prometheus.Labels{"check": strings.TrimSpace(name)}).
+			Set(helpers.BoolToFloat(healthyVsanState(check.Get("status", ""))))
+	}
+
+	return joinErrors(errs)
+}
@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// vsanStorageList is `esxcli vsan storage list` of a disk group on the
+// smartctl path, where drives are labelled by their display name
+const vsanStorageList = `[
+	{"Device": "t10.ATA_MZ7LH480", "Display Name": "Local ATA Disk (t10.ATA_MZ7LH480)", "Is SSD": "true",
+	 "VSAN UUID": "52a1b2c3-0001", "VSAN Disk Group UUID": "52a1b2c3-0001", "Is Capacity Tier": "false", "In CMMDS": "true"},
+	{"Device": "naa.5000c500a1b2c3d4", "Display Name": "Local SEAGATE Disk (naa.5000c500a1b2c3d4)", "Is SSD": "false",
+	 "VSAN UUID": "52a1b2c3-0002", "VSAN Disk Group UUID": "52a1b2c3-0001", "Is Capacity Tier": "true", "In CMMDS": "false"}
+]`
+
+func TestCollectVsanDriveLabels(t *testing.T) {
+	devices := `[
+		{"Device": "t10.ATA_MZ7LH480", "DisplayName": "Local ATA Disk (t10.ATA_MZ7LH480)", "IsSSD": "true"},
+		{"Device": "naa.5000c500a1b2c3d4", "DisplayName": "Local SEAGATE Disk (naa.5000c500a1b2c3d4)", "IsSSD": "false"}
+	]`
+	storage, storageBuild := newTestRun(t, esxcliExecutor{"storage core device list": devices}, "storage")
+	storage.collectStorage()
+	drives := make(map[string]bool)
+	for labels := range gauges(t, storageBuild, "drive_status") {
+		for _, pair := range strings.Split(labels, ",") {
+			if strings.HasPrefix(pair, "drive=") {
+				drives[strings.TrimPrefix(pair, "drive=")] = true
+			}
+		}
+	}
+
+	run, build := newTestRun(t, esxcliExecutor{"vsan storage list": vsanStorageList}, "vsan")
+	if err := run.collectVsan(); err == nil {
+		t.Error("got no error for the missing debug disk and health lists")
+	}
+	want := map[string]float64{
+		"device_id=t10.ATA_MZ7LH480,disk_group_uuid=52a1b2c3-0001,drive=Local ATA Disk,role=cache,vsan_uuid=52a1b2c3-0001":            1,
+		"device_id=naa.5000c500a1b2c3d4,disk_group_uuid=52a1b2c3-0001,drive=Local SEAGATE Disk,role=capacity,vsan_uuid=52a1b2c3-0002": 1,
+	}
+	got := gauges(t, build, "vsan_disk_info")
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got vsan_disk_info %v, want %v", got, want)
+	}
+	for _, drive := range []string{"Local ATA Disk", "Local SEAGATE Disk"} {
+		if !drives[drive] {
+			t.Errorf("vSAN drive %q has no drive_status series among %v", drive, drives)
+		}
+	}
+}
+
+func TestCollectVsanCombinesErrors(t *testing.T) {
+	run, _ := newTestRun(t, esxcliExecutor{}, "vsan")
+	err := run.collectVsan()
+	if err == nil {
+		t.Fatal("got no error")
+	}
+	for _, command := range []string{"vsan storage list", "vsan debug disk list", "vsan health cluster list"} {
+		if !strings.Contains(err.Error(), command) {
+			t.Errorf("error %q doesn't mention %s", err, command)
+		}
+	}
+}
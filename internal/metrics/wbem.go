@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"esxi_exporter/internal/wbem"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// cimSensorTypes maps CIM_NumericSensor.SensorType values to names
+var cimSensorTypes = map[string]string{
+	"0": "Unknown", "1": "Other", "2": "Temperature", "3": "Voltage", "4": "Current",
+	"5": "Tachometer", "6": "Counter", "7": "Switch", "8": "Lock", "9": "Humidity",
+	"10": "Smoke Detection", "11": "Presence", "12": "Air Flow", "13": "Power Consumption",
+	"14": "Power Production", "15": "Pressure", "16": "Intrusion",
+}
+
+// cimBaseUnits maps the CIM_NumericSensor.BaseUnits values seen on server hardware to units
+var cimBaseUnits = map[string]string{
+	"0": "Unknown", "1": "Other", "2": "Degrees C", "3": "Degrees F", "4": "Degrees K",
+	"5": "Volts", "6": "Amps", "7": "Watts", "8": "Joules", "9": "Coulombs",
+	"19": "RPM", "20": "Hertz", "65": "Percentage",
+}
+
+// cimSensorClasses are enumerated for sensor readings. OMC_RawIpmiSensor is
+// listed explicitly as not every provider derives it from CIM_NumericSensor;
+// where it does, the deep CIM_NumericSensor enumeration already returned
+// its instances and they are skipped.
+var cimSensorClasses = []string{"CIM_NumericSensor", "OMC_RawIpmiSensor"}
+
+// cimDriveClasses are enumerated for drive health
+var cimDriveClasses = []string{"CIM_PhysicalDrive", "VMware_StorageExtent"}
+
+// collectWbem exports sensor and drive health from the host CIM server. A
+// class that fails to enumerate doesn't stop the others; the failures are
+// returned together.
+func (m *Metrics) collectWbem() error {
+	if m.config.Wbem.URL == "" {
+		return fmt.Errorf("wbem url is not configured")
+	}
+
+	var errs []error
+	seen := make(map[string]bool)
+	for _, className := range cimSensorClasses {
+		sensors, err := m.wbem.EnumerateInstances(className)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, sensor := range sensors {
+			key := sensor.ClassName + "\xff" + sensor.Get("DeviceID", "")
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			m.exportCimSensor(sensor)
+		}
+	}
+
+	for _, className := range cimDriveClasses {
+		drives, err := m.wbem.EnumerateInstances(className)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, drive := range drives {
+			deviceID := drive.Get("DeviceID", drive.Get("Tag", ""))
+			if deviceID == "" {
+				continue
+			}
+			if health, ok := drive.Float("HealthState"); ok {
+				m.metrics["cim_drive_health_state"].With(prometheus.Labels{
+					"class":     drive.ClassName,
+					"device_id": deviceID,
+					"name":      drive.Get("ElementName", deviceID),
+				}).Set(health)
+			}
+		}
+	}
+
+	return joinErrors(errs)
+}
+
+// exportCimSensor sets the reading and health of a CIM numeric sensor
+func (m *Metrics) exportCimSensor(sensor wbem.Instance) {
+	deviceID := sensor.Get("DeviceID", "")
+	if deviceID == "" {
+		return
+	}
+	name := sensor.Get("ElementName", deviceID)
+	sensorType, ok := cimSensorTypes[sensor.Get("SensorType", "0")]
+	if !ok {
+		sensorType = "Unknown"
+	}
+
+	if reading, ok := sensor.Float("CurrentReading"); ok {
+		unit, ok := cimBaseUnits[sensor.Get("BaseUnits", "0")]
+		if !ok {
+			unit = "Unknown"
+		}
+		// Readings are scaled by 10^UnitModifier
+		if modifier, err := strconv.Atoi(sensor.Get("UnitModifier", "0")); err == nil {
+			reading *= math.Pow10(modifier)
+		}
+		m.metrics["cim_sensor_reading"].With(prometheus.Labels{
+			"class":     sensor.ClassName,
+			"device_id": deviceID,
+			"sensor":    name,
+			"type":      sensorType,
+			"unit":      unit,
+		}).Set(reading)
+	}
+
+	if health, ok := sensor.Float("HealthState"); ok {
+		m.metrics["cim_sensor_health_state"].With(prometheus.Labels{
+			"class":     sensor.ClassName,
+			"device_id": deviceID,
+			"sensor":    name,
+			"type":      sensorType,
+		}).Set(health)
+	}
+}
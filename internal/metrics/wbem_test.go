@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"context"
+	"esxi_exporter/internal/config"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeCIMOM answers EnumerateInstances of each class with its recorded
+// response, or with a 500 when the class has no fixture
+func fakeCIMOM(t *testing.T, fixtures map[string]string) *httptest.Server {
+	responses := make(map[string][]byte, len(fixtures))
+	for class, fixture := range fixtures {
+		response, err := ioutil.ReadFile(filepath.Join("testdata", fixture))
+		if err != nil {
+			t.Fatal(err)
+		}
+		responses[class] = response
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		for class, response := range responses {
+			if strings.Contains(string(body), `<CLASSNAME NAME="`+class+`"/>`) {
+				w.Header().Set("Content-Type", `application/xml; charset="utf-8"`)
+				w.Write(response)
+				return
+			}
+		}
+		http.Error(w, "provider failed", http.StatusInternalServerError)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newWbemRun(t *testing.T, fixtures map[string]string) (*Metrics, func(family string) map[string]float64) {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Wbem.URL = fakeCIMOM(t, fixtures).URL
+	pm, err := NewMetrics(cfg, esxcliExecutor{}, []string{"wbem"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	run, build := pm.newRun(context.Background())
+	return run, func(family string) map[string]float64 { return gauges(t, build, family) }
+}
+
+func TestCollectWbem(t *testing.T) {
+	run, gathered := newWbemRun(t, map[string]string{
+		"CIM_NumericSensor":    "wbem_numeric_sensors.xml",
+		"OMC_RawIpmiSensor":    "wbem_raw_ipmi_sensors.xml",
+		"CIM_PhysicalDrive":    "wbem_physical_drives.xml",
+		"VMware_StorageExtent": "wbem_storage_extents.xml",
+	})
+	if err := run.collectWbem(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The fan is returned by both sensor enumerations and exported once
+	for family, want := range map[string]map[string]float64{
+		"cim_sensor_reading": {
+			"class=OMC_NumericSensor,device_id=0.0.1.0,sensor=System Board 1 Inlet Temp,type=Temperature,unit=Degrees C": 23,
+			"class=OMC_RawIpmiSensor,device_id=52.0.32.99,sensor=Power Supply 1 Fan,type=Tachometer,unit=RPM":            6840,
+			"class=OMC_RawIpmiSensor,device_id=10.0.32.97,sensor=Power Supply 1 Current,type=Current,unit=Amps":          0.6,
+		},
+		"cim_sensor_health_state": {
+			"class=OMC_NumericSensor,device_id=0.0.1.0,sensor=System Board 1 Inlet Temp,type=Temperature": 5,
+			"class=OMC_RawIpmiSensor,device_id=52.0.32.99,sensor=Power Supply 1 Fan,type=Tachometer":      10,
+			"class=OMC_RawIpmiSensor,device_id=10.0.32.97,sensor=Power Supply 1 Current,type=Current":     5,
+		},
+		"cim_drive_health_state": {
+			"class=OMC_DiskDrive,device_id=Disk 0 in Backplane 1 of Integrated Storage Controller 1,name=Physical Disk 0:1:0": 5,
+			"class=VMware_StorageExtent,device_id=naa.600508b1001c4d41,name=naa.600508b1001c4d41":                             25,
+		},
+	} {
+		if got := gathered(family); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s:\ngot  %v\nwant %v", family, got, want)
+		}
+	}
+}
+
+func TestCollectWbemCombinesErrors(t *testing.T) {
+	run, gathered := newWbemRun(t, map[string]string{
+		"CIM_NumericSensor": "wbem_numeric_sensors.xml",
+		"CIM_PhysicalDrive": "wbem_physical_drives.xml",
+	})
+	err := run.collectWbem()
+	if err == nil {
+		t.Fatal("got no error")
+	}
+	for _, class := range []string{"OMC_RawIpmiSensor", "VMware_StorageExtent"} {
+		if !strings.Contains(err.Error(), class) {
+			t.Errorf("error %q doesn't mention %s", err, class)
+		}
+	}
+	if n := len(gathered("cim_sensor_reading")); n != 2 {
+		t.Errorf("got %d sensor readings, want the 2 of CIM_NumericSensor", n)
+	}
+	if n := len(gathered("cim_drive_health_state")); n != 1 {
+		t.Errorf("got %d drives, want the one of CIM_PhysicalDrive", n)
+	}
+}
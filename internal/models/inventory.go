@@ -0,0 +1,108 @@
+package models
+
+import "time"
+
+// SchemaVersion is the version of the /api/v1 JSON documents. It changes
+// only on incompatible changes; fields may be added within a version.
+const SchemaVersion = 1
+
+// Component states used in the JSON documents
+const (
+	StateOptimal          = "optimal"
+	StateOnline           = "online"
+	StateHealthy          = "healthy"
+	StateSpare            = "spare"
+	StateUnconfiguredGood = "unconfigured_good"
+	StateOther            = "other"
+)
+
+// Inventory is the storage inventory of a host, served by /api/v1/inventory
+type Inventory struct {
+	SchemaVersion int          `json:"schema_version"`
+	Host          string       `json:"host"`
+	CollectedAt   time.Time    `json:"collected_at"`
+	Controllers   []Controller `json:"controllers"`
+}
+
+// Controller is a RAID controller or HBA, or "esxcli" for drives found
+// without one
+type Controller struct {
+	ID                 string          `json:"id"`
+	Source             string          `json:"source"`
+	Model              string          `json:"model,omitempty"`
+	Serial             string          `json:"serial,omitempty"`
+	FirmwareVersion    string          `json:"firmware_version,omitempty"`
+	State              string          `json:"state,omitempty"`
+	TemperatureCelsius *float64        `json:"temperature_celsius,omitempty"`
+	BBU                *BBU            `json:"bbu,omitempty"`
+	Enclosures         []Enclosure     `json:"enclosures"`
+	PhysicalDrives     []PhysicalDrive `json:"physical_drives"`
+	VirtualDrives      []VirtualDrive  `json:"virtual_drives"`
+}
+
+// BBU is the battery backup unit of a controller
+type BBU struct {
+	State string `json:"state"`
+}
+
+// Enclosure is a backplane attached to a controller
+type Enclosure struct {
+	ID        string   `json:"id"`
+	ProductID string   `json:"product_id,omitempty"`
+	Vendor    string   `json:"vendor,omitempty"`
+	State     string   `json:"state,omitempty"`
+	Slots     *float64 `json:"slots,omitempty"`
+	Drives    *float64 `json:"drives,omitempty"`
+}
+
+// PhysicalDrive is a disk behind a controller
+type PhysicalDrive struct {
+	ID                 string             `json:"id"`
+	Model              string             `json:"model,omitempty"`
+	Protocol           string             `json:"protocol,omitempty"`
+	State              string             `json:"state"`
+	TemperatureCelsius *float64           `json:"temperature_celsius,omitempty"`
+	FailurePredicted   *bool              `json:"failure_predicted,omitempty"`
+	Smart              map[string]float64 `json:"smart,omitempty"`
+}
+
+// VirtualDrive is a RAID volume
+type VirtualDrive struct {
+	ID       string `json:"id"`
+	DeviceID string `json:"device_id,omitempty"`
+	State    string `json:"state"`
+}
+
+// Severities of health problems
+const (
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Health summarises the problems found in the last collections, served by
+// /api/v1/health
+type Health struct {
+	SchemaVersion int    `json:"schema_version"`
+	Host          string `json:"host"`
+	// Status is "ok" or the severity of the worst problem
+	Status     string            `json:"status"`
+	Problems   []Problem         `json:"problems"`
+	Collectors []CollectorHealth `json:"collectors"`
+}
+
+// Problem is an unhealthy component
+type Problem struct {
+	Severity   string `json:"severity"`
+	Component  string `json:"component"`
+	Controller string `json:"controller,omitempty"`
+	ID         string `json:"id"`
+	Message    string `json:"message"`
+}
+
+// CollectorHealth is the outcome of the last run of a collector
+type CollectorHealth struct {
+	Name            string    `json:"name"`
+	LastRun         time.Time `json:"last_run"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	Error           string    `json:"error,omitempty"`
+}
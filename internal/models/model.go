@@ -1,11 +1,29 @@
 package models
 
-// timeoutError is a custom error type for command timeouts
-type TimeoutError struct {
-	Stderr  string
-	Message string
+import "strings"
+
+// CommandError describes a command that failed to start, exited with a
+// non-zero status, timed out or was cancelled
+type CommandError struct {
+	Command string
+	// ExitCode is the exit status of the command, -1 when it did not exit
+	// on its own
+	ExitCode int
+	Stderr   string
+	Message  string
+	// TimedOut is set when the command was killed at its deadline
+	TimedOut bool
+}
+
+func (e *CommandError) Error() string {
+	msg := e.Command + ": " + e.Message
+	if stderr := strings.TrimSpace(e.Stderr); stderr != "" {
+		msg += ": " + stderr
+	}
+	return msg
 }
 
-func (e *TimeoutError) Error() string {
-	return e.Message + ": " + e.Stderr
+// Timeout reports whether the command was killed at its deadline
+func (e *CommandError) Timeout() bool {
+	return e.TimedOut
 }
@@ -0,0 +1,120 @@
+// Package probe serves multi-target /probe requests that collect metrics
+// from a remote ESXi host over SSH.
+package probe
+
+import (
+	"context"
+	"esxi_exporter/internal/config"
+	"esxi_exporter/internal/executor"
+	"esxi_exporter/internal/metrics"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// defaultModule runs every host collector when no module is requested
+const defaultModule = "default"
+
+// timeoutOffset is kept from the scrape timeout so the response makes it
+// back to Prometheus before it gives up
+const timeoutOffset = 500 * time.Millisecond
+
+// Handler serves /probe?target=<host>&module=<module>
+type Handler struct {
+	mtx    sync.Mutex
+	config *config.Config
+	pool   *executor.Pool
+}
+
+// NewHandler creates a probe handler running commands over connections from pool
+func NewHandler(cfg *config.Config, pool *executor.Pool) *Handler {
+	return &Handler{config: cfg, pool: pool}
+}
+
+// SetConfig switches the modules and targets used by later probes
+func (h *Handler) SetConfig(cfg *config.Config) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.config = cfg
+}
+
+// ServeHTTP runs the module's collectors against the target and returns its metrics
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		http.Error(w, "target parameter is missing", http.StatusBadRequest)
+		return
+	}
+	moduleName := r.URL.Query().Get("module")
+	if moduleName == "" {
+		moduleName = defaultModule
+	}
+
+	h.mtx.Lock()
+	probeConfig := h.config
+	h.mtx.Unlock()
+
+	exec, err := h.pool.Executor(target)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The redfish collector talks to the target's own BMC
+	cfg := *probeConfig
+	cfg.Redfish = probeConfig.Targets[target].Redfish
+
+	module, ok := probeConfig.Modules[moduleName]
+	if !ok {
+		if moduleName != defaultModule {
+			http.Error(w, "unknown module "+moduleName, http.StatusBadRequest)
+			return
+		}
+		module.Collectors = metrics.HostCollectorNames(&cfg)
+	}
+
+	m, err := metrics.NewMetrics(&cfg, exec, module.Collectors)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	m.SetHost(target)
+
+	ctx := r.Context()
+	if timeout, err := scrapeTimeout(r); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	log.Printf("Probing %s with module %s", target, moduleName)
+	m.CollectMetrics(ctx)
+
+	promhttp.HandlerFor(m.Gatherer(), promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
+
+// scrapeTimeout returns the time left for the probe from the
+// X-Prometheus-Scrape-Timeout-Seconds header, or 0 without one
+func scrapeTimeout(r *http.Request) (time.Duration, error) {
+	header := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds")
+	if header == "" {
+		return 0, nil
+	}
+	seconds, err := strconv.ParseFloat(header, 64)
+	if err != nil || seconds <= 0 {
+		return 0, fmt.Errorf("invalid X-Prometheus-Scrape-Timeout-Seconds %q", header)
+	}
+	timeout := time.Duration(seconds * float64(time.Second))
+	if timeout > 2*timeoutOffset {
+		timeout -= timeoutOffset
+	}
+	return timeout, nil
+}
@@ -0,0 +1,177 @@
+// Package redfish is a minimal DMTF Redfish client used to read storage,
+// thermal and power state from a BMC such as iDRAC.
+package redfish
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"esxi_exporter/internal/config"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Link is a reference to another Redfish resource
+type Link struct {
+	ID string `json:"@odata.id"`
+}
+
+// Collection is a Redfish resource collection
+type Collection struct {
+	Members []Link `json:"Members"`
+}
+
+// Status is the common Redfish status object
+type Status struct {
+	State  string `json:"State"`
+	Health string `json:"Health"`
+}
+
+// OK reports whether the resource is enabled and healthy
+func (s Status) OK() bool {
+	return s.Health == "OK" && (s.State == "" || s.State == "Enabled")
+}
+
+// System is a ComputerSystem resource
+type System struct {
+	ID      string `json:"Id"`
+	Storage Link   `json:"Storage"`
+}
+
+// Storage is a Storage resource, one per RAID controller or HBA
+type Storage struct {
+	ID                 string              `json:"Id"`
+	Name               string              `json:"Name"`
+	StorageControllers []StorageController `json:"StorageControllers"`
+	Drives             []Link              `json:"Drives"`
+	Volumes            Link                `json:"Volumes"`
+	Status             Status              `json:"Status"`
+}
+
+// StorageController is an entry of Storage.StorageControllers
+type StorageController struct {
+	MemberID        string `json:"MemberId"`
+	Name            string `json:"Name"`
+	Model           string `json:"Model"`
+	SerialNumber    string `json:"SerialNumber"`
+	FirmwareVersion string `json:"FirmwareVersion"`
+	Status          Status `json:"Status"`
+}
+
+// Drive is a Drive resource
+type Drive struct {
+	ID               string `json:"Id"`
+	Name             string `json:"Name"`
+	Model            string `json:"Model"`
+	Protocol         string `json:"Protocol"`
+	MediaType        string `json:"MediaType"`
+	FailurePredicted bool   `json:"FailurePredicted"`
+	Status           Status `json:"Status"`
+}
+
+// Volume is a Volume resource (a virtual drive)
+type Volume struct {
+	ID       string `json:"Id"`
+	Name     string `json:"Name"`
+	RAIDType string `json:"RAIDType"`
+	Status   Status `json:"Status"`
+}
+
+// Chassis is a Chassis resource
+type Chassis struct {
+	ID      string `json:"Id"`
+	Thermal Link   `json:"Thermal"`
+	Power   Link   `json:"Power"`
+}
+
+// Thermal is the legacy Chassis Thermal resource
+type Thermal struct {
+	Temperatures []struct {
+		Name           string   `json:"Name"`
+		ReadingCelsius *float64 `json:"ReadingCelsius"`
+		Status         Status   `json:"Status"`
+	} `json:"Temperatures"`
+	Fans []struct {
+		Name         string   `json:"Name"`
+		Reading      *float64 `json:"Reading"`
+		ReadingUnits string   `json:"ReadingUnits"`
+		Status       Status   `json:"Status"`
+	} `json:"Fans"`
+}
+
+// Power is the legacy Chassis Power resource
+type Power struct {
+	PowerControl []struct {
+		Name               string   `json:"Name"`
+		PowerConsumedWatts *float64 `json:"PowerConsumedWatts"`
+	} `json:"PowerControl"`
+	PowerSupplies []struct {
+		Name   string `json:"Name"`
+		Status Status `json:"Status"`
+	} `json:"PowerSupplies"`
+	Voltages []struct {
+		Name         string   `json:"Name"`
+		ReadingVolts *float64 `json:"ReadingVolts"`
+		Status       Status   `json:"Status"`
+	} `json:"Voltages"`
+}
+
+// Client talks to a single Redfish service
+type Client struct {
+	baseURL    string
+	username   string
+	password   string
+	httpClient *http.Client
+}
+
+// NewClient creates a client for the Redfish service described by cfg
+func NewClient(cfg config.RedfishConfig) *Client {
+	return &Client{
+		baseURL:  strings.TrimSuffix(cfg.URL, "/"),
+		username: cfg.Username,
+		password: cfg.Password,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify},
+			},
+		},
+	}
+}
+
+// Get fetches the resource at path (an @odata.id such as /redfish/v1/Systems) into out
+func (c *Client) Get(path string, out interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(c.username, c.password)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("GET %s: %s: %s", path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding %s: %v", path, err)
+	}
+	return nil
+}
+
+// Members fetches a collection and returns the links of its members
+func (c *Client) Members(path string) ([]Link, error) {
+	var collection Collection
+	if err := c.Get(path, &collection); err != nil {
+		return nil, err
+	}
+	return collection.Members, nil
+}
@@ -0,0 +1,149 @@
+package redfish
+
+import (
+	"esxi_exporter/internal/config"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// mockBMC serves the recorded iDRAC responses in testdata
+func mockBMC(t *testing.T) *httptest.Server {
+	fixtures := map[string]string{
+		"/redfish/v1/Systems": "systems.json",
+		"/redfish/v1/Systems/System.Embedded.1/Storage/RAID.Integrated.1-1":                                          "storage.json",
+		"/redfish/v1/Systems/System.Embedded.1/Storage/Drives/Disk.Bay.0:Enclosure.Internal.0-1:RAID.Integrated.1-1": "drive.json",
+		"/redfish/v1/Chassis/System.Embedded.1/Thermal":                                                              "thermal.json",
+		"/redfish/v1/Chassis/System.Embedded.1/Power":                                                                "power.json",
+		"/redfish/v1/Broken": "",
+	}
+	bodies := make(map[string][]byte, len(fixtures))
+	for path, fixture := range fixtures {
+		if fixture == "" {
+			continue
+		}
+		body, err := ioutil.ReadFile(filepath.Join("testdata", fixture))
+		if err != nil {
+			t.Fatal(err)
+		}
+		bodies[path] = body
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, _ := r.BasicAuth(); user != "monitoring" || password != "secret" {
+			http.Error(w, `{"error":{"code":"Base.1.8.AccessDenied"}}`, http.StatusUnauthorized)
+			return
+		}
+		fixture, ok := fixtures[r.URL.Path]
+		if !ok {
+			http.Error(w, `{"error":{"code":"Base.1.8.ResourceMissingAtURI"}}`, http.StatusNotFound)
+			return
+		}
+		if fixture == "" {
+			w.Write([]byte(`{"Id": `))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(bodies[r.URL.Path])
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestClient(t *testing.T, password string) *Client {
+	return NewClient(config.RedfishConfig{URL: mockBMC(t).URL + "/", Username: "monitoring", Password: password})
+}
+
+func TestMembers(t *testing.T) {
+	members, err := newTestClient(t, "secret").Members("/redfish/v1/Systems")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 1 || members[0].ID != "/redfish/v1/Systems/System.Embedded.1" {
+		t.Errorf("Members() = %+v", members)
+	}
+}
+
+func TestStorage(t *testing.T) {
+	c := newTestClient(t, "secret")
+	var storage Storage
+	if err := c.Get("/redfish/v1/Systems/System.Embedded.1/Storage/RAID.Integrated.1-1", &storage); err != nil {
+		t.Fatal(err)
+	}
+	if len(storage.StorageControllers) != 1 || len(storage.Drives) != 1 {
+		t.Fatalf("storage = %+v", storage)
+	}
+	controller := storage.StorageControllers[0]
+	if controller.Model != "PERC H730P Mini" || controller.SerialNumber != "5CG00Q1" || controller.FirmwareVersion != "25.5.9.0001" || !controller.Status.OK() {
+		t.Errorf("controller = %+v", controller)
+	}
+	if storage.Volumes.ID != "/redfish/v1/Systems/System.Embedded.1/Storage/RAID.Integrated.1-1/Volumes" {
+		t.Errorf("volumes link = %q", storage.Volumes.ID)
+	}
+
+	var drive Drive
+	if err := c.Get(storage.Drives[0].ID, &drive); err != nil {
+		t.Fatal(err)
+	}
+	if drive.Model != "ST600MM0088" || drive.Protocol != "SAS" || !drive.FailurePredicted || drive.Status.OK() {
+		t.Errorf("drive = %+v", drive)
+	}
+}
+
+func TestThermalAndPower(t *testing.T) {
+	c := newTestClient(t, "secret")
+	var thermal Thermal
+	if err := c.Get("/redfish/v1/Chassis/System.Embedded.1/Thermal", &thermal); err != nil {
+		t.Fatal(err)
+	}
+	if len(thermal.Fans) != 2 || thermal.Fans[0].Reading == nil || *thermal.Fans[0].Reading != 5880 || thermal.Fans[1].Reading != nil {
+		t.Errorf("fans = %+v", thermal.Fans)
+	}
+	if len(thermal.Temperatures) != 1 || *thermal.Temperatures[0].ReadingCelsius != 23 {
+		t.Errorf("temperatures = %+v", thermal.Temperatures)
+	}
+
+	var power Power
+	if err := c.Get("/redfish/v1/Chassis/System.Embedded.1/Power", &power); err != nil {
+		t.Fatal(err)
+	}
+	if *power.PowerControl[0].PowerConsumedWatts != 182 || !power.PowerSupplies[0].Status.OK() || power.PowerSupplies[1].Status.OK() {
+		t.Errorf("power = %+v", power)
+	}
+}
+
+func TestStatusOK(t *testing.T) {
+	for _, tc := range []struct {
+		status Status
+		want   bool
+	}{
+		{Status{Health: "OK", State: "Enabled"}, true},
+		{Status{Health: "OK"}, true},
+		{Status{Health: "OK", State: "Disabled"}, false},
+		{Status{Health: "Warning", State: "Enabled"}, false},
+		{Status{State: "Absent"}, false},
+	} {
+		if got := tc.status.OK(); got != tc.want {
+			t.Errorf("%+v.OK() = %v, want %v", tc.status, got, tc.want)
+		}
+	}
+}
+
+func TestGetErrors(t *testing.T) {
+	c := newTestClient(t, "secret")
+	var out struct{}
+	for path, want := range map[string]string{
+		"/redfish/v1/Systems/Missing": "404",
+		"/redfish/v1/Broken":          "decoding /redfish/v1/Broken",
+	} {
+		if err := c.Get(path, &out); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Get(%s): error %v, want %s", path, err, want)
+		}
+	}
+
+	if _, err := newTestClient(t, "wrong").Members("/redfish/v1/Systems"); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("wrong password: error %v, want a 401", err)
+	}
+}
@@ -0,0 +1,149 @@
+// Package remotewrite sends metrics to a Prometheus remote_write endpoint
+// (protobuf WriteRequest, snappy compressed).
+package remotewrite
+
+import (
+	"bytes"
+	"context"
+	"esxi_exporter/internal/retry"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/snappy"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Client sends WriteRequests to a single endpoint
+type Client struct {
+	url        string
+	httpClient *http.Client
+	// Retry bounds the retries of network errors, 5xx and 429 responses
+	Retry retry.Policy
+}
+
+// NewClient creates a client for the remote_write endpoint at url
+func NewClient(url string) *Client {
+	return &Client{
+		url:        url,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		Retry:      retry.Default,
+	}
+}
+
+// Write sends the gauge, counter and untyped samples of families as one
+// request. Every series gets labels in addition to its own; samples
+// without a timestamp are stamped with timestamp.
+func (c *Client) Write(ctx context.Context, families []*dto.MetricFamily, labels map[string]string, timestamp time.Time) error {
+	body := snappy.Encode(nil, Encode(families, labels, timestamp))
+
+	return c.Retry.Do(ctx, "Remote write to "+c.url, func() error {
+		return c.send(ctx, body)
+	})
+}
+
+// send posts one compressed WriteRequest
+func (c *Client) send(ctx context.Context, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "esxi_exporter")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return retry.Recoverable(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("POST %s: %s: %s", c.url, resp.Status, strings.TrimSpace(string(msg)))
+	if retry.RecoverableStatus(resp.StatusCode) {
+		return retry.Recoverable(err)
+	}
+	return err
+}
+
+// Encode builds the uncompressed WriteRequest protobuf. Summaries and
+// histograms are skipped as the exporter exposes none.
+func Encode(families []*dto.MetricFamily, labels map[string]string, timestamp time.Time) []byte {
+	var request []byte
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			var value float64
+			switch family.GetType() {
+			case dto.MetricType_GAUGE:
+				value = metric.GetGauge().GetValue()
+			case dto.MetricType_COUNTER:
+				value = metric.GetCounter().GetValue()
+			case dto.MetricType_UNTYPED:
+				value = metric.GetUntyped().GetValue()
+			default:
+				continue
+			}
+
+			seriesLabels := map[string]string{"__name__": family.GetName()}
+			for _, pair := range metric.GetLabel() {
+				seriesLabels[pair.GetName()] = pair.GetValue()
+			}
+			for name, val := range labels {
+				if _, ok := seriesLabels[name]; !ok {
+					seriesLabels[name] = val
+				}
+			}
+			ts := timestamp.UnixNano() / int64(time.Millisecond)
+			if metric.TimestampMs != nil {
+				ts = metric.GetTimestampMs()
+			}
+
+			request = protowire.AppendTag(request, 1, protowire.BytesType)
+			request = protowire.AppendBytes(request, encodeTimeSeries(seriesLabels, value, ts))
+		}
+	}
+	return request
+}
+
+// encodeTimeSeries encodes a TimeSeries with one sample. Labels are sorted
+// by name as remote_write requires.
+func encodeTimeSeries(labels map[string]string, value float64, timestamp int64) []byte {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var series []byte
+	for _, name := range names {
+		var label []byte
+		label = protowire.AppendTag(label, 1, protowire.BytesType)
+		label = protowire.AppendString(label, name)
+		label = protowire.AppendTag(label, 2, protowire.BytesType)
+		label = protowire.AppendString(label, labels[name])
+
+		series = protowire.AppendTag(series, 1, protowire.BytesType)
+		series = protowire.AppendBytes(series, label)
+	}
+
+	var sample []byte
+	sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+	sample = protowire.AppendFixed64(sample, math.Float64bits(value))
+	sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+	sample = protowire.AppendVarint(sample, uint64(timestamp))
+
+	series = protowire.AppendTag(series, 2, protowire.BytesType)
+	series = protowire.AppendBytes(series, sample)
+	return series
+}
@@ -0,0 +1,132 @@
+package remotewrite
+
+import (
+	"context"
+	"esxi_exporter/internal/retry"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+var testFamilies = []*dto.MetricFamily{{
+	Name: proto.String("esxi_drive_temp"),
+	Type: dto.MetricType_GAUGE.Enum(),
+	Metric: []*dto.Metric{{
+		Label: []*dto.LabelPair{
+			{Name: proto.String("source"), Value: proto.String("perccli")},
+			{Name: proto.String("controller"), Value: proto.String("0")},
+			{Name: proto.String("drive"), Value: proto.String("Drive /c0/e32/s0")},
+		},
+		Gauge: &dto.Gauge{Value: proto.Float64(34)},
+	}},
+}}
+
+// fields splits a protobuf message into its length-delimited fields by number
+func fields(t *testing.T, b []byte) map[protowire.Number][][]byte {
+	t.Helper()
+	out := make(map[protowire.Number][][]byte)
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatalf("bad tag: %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+		if typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			b = b[n:]
+			continue
+		}
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			t.Fatalf("bad field: %v", protowire.ParseError(n))
+		}
+		out[num] = append(out[num], v)
+		b = b[n:]
+	}
+	return out
+}
+
+func testClient(url string) *Client {
+	c := NewClient(url)
+	c.Retry = retry.Policy{Retries: 3, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	return c
+}
+
+func TestWrite(t *testing.T) {
+	var names []string
+	labels := make(map[string]string)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "snappy" {
+			t.Errorf("Content-Encoding = %q, want snappy", r.Header.Get("Content-Encoding"))
+		}
+		compressed, _ := ioutil.ReadAll(r.Body)
+		body, err := snappy.Decode(nil, compressed)
+		if err != nil {
+			t.Errorf("decoding body: %v", err)
+			return
+		}
+		series := fields(t, body)[1]
+		if len(series) != 1 {
+			t.Errorf("got %d series, want 1", len(series))
+			return
+		}
+		for _, label := range fields(t, series[0])[1] {
+			pair := fields(t, label)
+			name, value := string(pair[1][0]), string(pair[2][0])
+			names = append(names, name)
+			labels[name] = value
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	err := testClient(srv.URL).Write(context.Background(), testFamilies, map[string]string{"job": "esxi_exporter", "instance": "esx01"}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sort.StringsAreSorted(names) {
+		t.Errorf("labels not sorted: %v", names)
+	}
+	want := map[string]string{"__name__": "esxi_drive_temp", "controller": "0", "drive": "Drive /c0/e32/s0", "source": "perccli", "job": "esxi_exporter", "instance": "esx01"}
+	for name, value := range want {
+		if labels[name] != value {
+			t.Errorf("label %s = %q, want %q", name, labels[name], value)
+		}
+	}
+	if len(labels) != len(want) {
+		t.Errorf("got labels %v, want %v", labels, want)
+	}
+}
+
+func TestWriteRetries(t *testing.T) {
+	for _, tc := range []struct {
+		statuses  []int
+		wantCalls int
+		wantErr   bool
+	}{
+		{[]int{http.StatusServiceUnavailable, http.StatusNoContent}, 2, false},
+		{[]int{http.StatusTooManyRequests, http.StatusOK}, 2, false},
+		{[]int{http.StatusBadRequest}, 1, true},
+		{[]int{500, 500, 500, 500}, 4, true},
+	} {
+		calls := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tc.statuses[calls])
+			calls++
+		}))
+
+		err := testClient(srv.URL).Write(context.Background(), testFamilies, nil, time.Now())
+		srv.Close()
+		if calls != tc.wantCalls || (err != nil) != tc.wantErr {
+			t.Errorf("statuses %v: got %d calls and error %v, want %d calls and error %v", tc.statuses, calls, err, tc.wantCalls, tc.wantErr)
+		}
+	}
+}
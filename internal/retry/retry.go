@@ -0,0 +1,72 @@
+// Package retry retries failed requests with capped exponential backoff.
+package retry
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Policy bounds the retries of a request
+type Policy struct {
+	// Retries is the number of times a failed request is retried, waiting
+	// MinBackoff and doubling up to MaxBackoff in between
+	Retries    int
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// Default is the policy of the push modes
+var Default = Policy{Retries: 5, MinBackoff: 500 * time.Millisecond, MaxBackoff: 30 * time.Second}
+
+// recoverableError marks a failure worth retrying
+type recoverableError struct {
+	error
+}
+
+// Recoverable marks err as worth retrying
+func Recoverable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return recoverableError{err}
+}
+
+// IsRecoverable reports whether err was marked with Recoverable
+func IsRecoverable(err error) bool {
+	_, ok := err.(recoverableError)
+	return ok
+}
+
+// RecoverableStatus reports whether an HTTP response status is worth
+// retrying: a 5xx or a 429
+func RecoverableStatus(code int) bool {
+	return code/100 == 5 || code == http.StatusTooManyRequests
+}
+
+// Do calls f until it succeeds, returns an error that isn't recoverable,
+// runs out of retries or ctx is done. what names the request in logs.
+func (p Policy) Do(ctx context.Context, what string, f func() error) error {
+	backoff := p.MinBackoff
+	for attempt := 0; ; attempt++ {
+		err := f()
+		if err == nil {
+			return nil
+		}
+		if !IsRecoverable(err) || attempt >= p.Retries {
+			return err
+		}
+		log.Printf("%s failed, retrying in %v: %v", what, backoff, err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > p.MaxBackoff {
+			backoff = p.MaxBackoff
+		}
+	}
+}
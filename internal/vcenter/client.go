@@ -0,0 +1,242 @@
+// Package vcenter is a minimal client for the vSphere Automation REST API
+// (/api) and the vSphere Web Services JSON API (/sdk/vim25) used to read
+// fleet-wide state from a vCenter Server.
+package vcenter
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"esxi_exporter/internal/config"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Host is an entry of GET /api/vcenter/host
+type Host struct {
+	Host            string `json:"host"`
+	Name            string `json:"name"`
+	ConnectionState string `json:"connection_state"`
+	PowerState      string `json:"power_state"`
+}
+
+// Datastore is an entry of GET /api/vcenter/datastore
+type Datastore struct {
+	Datastore string `json:"datastore"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	FreeSpace int64  `json:"free_space"`
+	Capacity  int64  `json:"capacity"`
+}
+
+// VM is an entry of GET /api/vcenter/vm
+type VM struct {
+	VM         string `json:"vm"`
+	Name       string `json:"name"`
+	PowerState string `json:"power_state"`
+}
+
+// MoRef is a managed object reference as serialised by the vim25 JSON API
+type MoRef struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// AlarmState is a triggered alarm as returned by the triggeredAlarmState property
+type AlarmState struct {
+	Key           string `json:"key"`
+	Entity        MoRef  `json:"entity"`
+	Alarm         MoRef  `json:"alarm"`
+	OverallStatus string `json:"overallStatus"`
+	Acknowledged  bool   `json:"acknowledged"`
+}
+
+// Client talks to a single vCenter Server
+type Client struct {
+	baseURL    string
+	username   string
+	password   string
+	vimRelease string
+	httpClient *http.Client
+
+	session    string
+	vimSession string
+}
+
+// NewClient creates a client for the vCenter described by cfg
+func NewClient(cfg config.VcenterConfig) *Client {
+	return &Client{
+		baseURL:    strings.TrimSuffix(cfg.URL, "/"),
+		username:   cfg.Username,
+		password:   cfg.Password,
+		vimRelease: cfg.VimRelease,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify},
+			},
+		},
+	}
+}
+
+// Login creates an Automation API session
+func (c *Client) Login() error {
+	req, err := http.NewRequest(http.MethodPost, c.baseURL+"/api/session", nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(c.username, c.password)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return statusError(resp)
+	}
+
+	var token string
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return fmt.Errorf("decoding session token: %v", err)
+	}
+	c.session = token
+	return nil
+}
+
+// vimLogin creates a vim25 JSON API session
+func (c *Client) vimLogin() error {
+	body, err := json.Marshal(map[string]string{"userName": c.username, "password": c.password})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, c.vimURL("SessionManager/SessionManager/Login"), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return statusError(resp)
+	}
+	c.vimSession = resp.Header.Get("vmware-api-session-id")
+	if c.vimSession == "" {
+		return fmt.Errorf("vim25 login returned no session id")
+	}
+	return nil
+}
+
+// Hosts lists the ESXi hosts managed by vCenter
+func (c *Client) Hosts() ([]Host, error) {
+	var hosts []Host
+	err := c.getAPI("/api/vcenter/host", &hosts)
+	return hosts, err
+}
+
+// Datastores lists the datastores known to vCenter
+func (c *Client) Datastores() ([]Datastore, error) {
+	var datastores []Datastore
+	err := c.getAPI("/api/vcenter/datastore", &datastores)
+	return datastores, err
+}
+
+// VMs lists the virtual machines running on the given host
+func (c *Client) VMs(host string) ([]VM, error) {
+	var vms []VM
+	err := c.getAPI("/api/vcenter/vm?hosts="+url.QueryEscape(host), &vms)
+	return vms, err
+}
+
+// TriggeredAlarms lists the alarms triggered anywhere in the inventory
+func (c *Client) TriggeredAlarms() ([]AlarmState, error) {
+	var alarms []AlarmState
+	err := c.getVim("Folder/group-d1/triggeredAlarmState", &alarms)
+	return alarms, err
+}
+
+// AlarmName resolves an alarm reference to its display name
+func (c *Client) AlarmName(alarm string) (string, error) {
+	var info struct {
+		Name string `json:"name"`
+	}
+	if err := c.getVim("Alarm/"+url.PathEscape(alarm)+"/info", &info); err != nil {
+		return "", err
+	}
+	return info.Name, nil
+}
+
+func (c *Client) vimURL(path string) string {
+	return c.baseURL + "/sdk/vim25/" + c.vimRelease + "/" + path
+}
+
+// getAPI fetches an Automation API resource, logging in again once if the session expired
+func (c *Client) getAPI(path string, out interface{}) error {
+	if c.session == "" {
+		if err := c.Login(); err != nil {
+			return err
+		}
+	}
+	status, err := c.get(c.baseURL+path, c.session, out)
+	if status == http.StatusUnauthorized {
+		if err := c.Login(); err != nil {
+			return err
+		}
+		_, err = c.get(c.baseURL+path, c.session, out)
+	}
+	return err
+}
+
+// getVim fetches a vim25 JSON API property, logging in again once if the session expired
+func (c *Client) getVim(path string, out interface{}) error {
+	if c.vimSession == "" {
+		if err := c.vimLogin(); err != nil {
+			return err
+		}
+	}
+	status, err := c.get(c.vimURL(path), c.vimSession, out)
+	if status == http.StatusUnauthorized {
+		if err := c.vimLogin(); err != nil {
+			return err
+		}
+		_, err = c.get(c.vimURL(path), c.vimSession, out)
+	}
+	return err
+}
+
+func (c *Client) get(target, session string, out interface{}) (int, error) {
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("vmware-api-session-id", session)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, statusError(resp)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return resp.StatusCode, fmt.Errorf("decoding %s: %v", req.URL.Path, err)
+	}
+	return resp.StatusCode, nil
+}
+
+func statusError(resp *http.Response) error {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("%s %s: %s: %s", resp.Request.Method, resp.Request.URL.Path, resp.Status, strings.TrimSpace(string(body)))
+}
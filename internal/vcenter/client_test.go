@@ -0,0 +1,179 @@
+package vcenter
+
+import (
+	"encoding/json"
+	"esxi_exporter/internal/config"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// standIn is a vCenter serving the recorded responses in testdata
+type standIn struct {
+	// bodies holds the recorded response of each resource path
+	bodies     map[string][]byte
+	mtx        sync.Mutex
+	logins     int
+	vimLogins  int
+	session    string
+	vimSession string
+	// fail answers every resource request with this status when set
+	fail int
+}
+
+func (s *standIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	switch r.URL.Path {
+	case "/api/session":
+		if user, password, _ := r.BasicAuth(); user != "monitoring" || password != "secret" {
+			http.Error(w, `{"error_type":"UNAUTHENTICATED"}`, http.StatusUnauthorized)
+			return
+		}
+		s.logins++
+		s.session = fmt.Sprintf("session-%d", s.logins)
+		json.NewEncoder(w).Encode(s.session)
+		return
+	case "/sdk/vim25/8.0.1.0/SessionManager/SessionManager/Login":
+		s.vimLogins++
+		s.vimSession = fmt.Sprintf("vim-%d", s.vimLogins)
+		w.Header().Set("vmware-api-session-id", s.vimSession)
+		w.Write([]byte(`{"_typeName":"UserSession","userName":"monitoring"}`))
+		return
+	}
+
+	if s.fail != 0 {
+		http.Error(w, "internal error", s.fail)
+		return
+	}
+
+	body, ok := s.bodies[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	session := s.session
+	if strings.HasPrefix(r.URL.Path, "/sdk/") {
+		session = s.vimSession
+	}
+	if r.Header.Get("vmware-api-session-id") != session {
+		http.Error(w, `{"error_type":"UNAUTHENTICATED"}`, http.StatusUnauthorized)
+		return
+	}
+	w.Write(body)
+}
+
+func newTestClient(t *testing.T, password string) (*Client, *standIn) {
+	s := &standIn{bodies: make(map[string][]byte)}
+	for path, fixture := range map[string]string{
+		"/api/vcenter/host":      "hosts.json",
+		"/api/vcenter/datastore": "datastores.json",
+		"/api/vcenter/vm":        "vms.json",
+		"/sdk/vim25/8.0.1.0/Folder/group-d1/triggeredAlarmState": "triggered_alarms.json",
+		"/sdk/vim25/8.0.1.0/Alarm/alarm-7/info":                  "alarm_info.json",
+	} {
+		body, err := ioutil.ReadFile(filepath.Join("testdata", fixture))
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.bodies[path] = body
+	}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	return NewClient(config.VcenterConfig{URL: srv.URL + "/", Username: "monitoring", Password: password, VimRelease: "8.0.1.0"}), s
+}
+
+func TestHosts(t *testing.T) {
+	c, _ := newTestClient(t, "secret")
+	hosts, err := c.Hosts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Host{
+		{Host: "host-10", Name: "esx01.example.com", ConnectionState: "CONNECTED", PowerState: "POWERED_ON"},
+		{Host: "host-12", Name: "esx02.example.com", ConnectionState: "NOT_RESPONDING", PowerState: "POWERED_ON"},
+	}
+	if fmt.Sprint(hosts) != fmt.Sprint(want) {
+		t.Errorf("Hosts() = %+v, want %+v", hosts, want)
+	}
+}
+
+func TestDatastoresAndVMs(t *testing.T) {
+	c, _ := newTestClient(t, "secret")
+	datastores, err := c.Datastores()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(datastores) != 1 || datastores[0].Name != "vsanDatastore" || datastores[0].Capacity != 8796093022208 || datastores[0].FreeSpace != 5497558138880 {
+		t.Errorf("Datastores() = %+v", datastores)
+	}
+
+	vms, err := c.VMs("host-10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vms) != 1 || vms[0] != (VM{VM: "vm-101", Name: "web01", PowerState: "POWERED_ON"}) {
+		t.Errorf("VMs() = %+v", vms)
+	}
+}
+
+func TestTriggeredAlarms(t *testing.T) {
+	c, _ := newTestClient(t, "secret")
+	alarms, err := c.TriggeredAlarms()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := AlarmState{
+		Key:           "alarm-7.host-12",
+		Entity:        MoRef{Type: "HostSystem", Value: "host-12"},
+		Alarm:         MoRef{Type: "Alarm", Value: "alarm-7"},
+		OverallStatus: "red",
+	}
+	if len(alarms) != 1 || alarms[0] != want {
+		t.Errorf("TriggeredAlarms() = %+v, want [%+v]", alarms, want)
+	}
+
+	name, err := c.AlarmName("alarm-7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "Host connection and power state" {
+		t.Errorf("AlarmName() = %q", name)
+	}
+}
+
+func TestSessionExpiry(t *testing.T) {
+	c, s := newTestClient(t, "secret")
+	if _, err := c.Hosts(); err != nil {
+		t.Fatal(err)
+	}
+	// vCenter dropped the session; the next request logs in again
+	s.mtx.Lock()
+	s.session = "expired"
+	s.mtx.Unlock()
+	if _, err := c.Hosts(); err != nil {
+		t.Fatal(err)
+	}
+	if s.logins != 2 {
+		t.Errorf("logged in %d times, want 2", s.logins)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	c, _ := newTestClient(t, "wrong")
+	if _, err := c.Hosts(); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Hosts() with a wrong password: error %v, want a 401", err)
+	}
+
+	c, s := newTestClient(t, "secret")
+	s.fail = http.StatusInternalServerError
+	if _, err := c.Datastores(); err == nil || !strings.Contains(err.Error(), "500") {
+		t.Errorf("Datastores() against a failing server: error %v, want a 500", err)
+	}
+}
@@ -0,0 +1,186 @@
+// Package wbem is a minimal CIM-XML (DSP0200) client able to enumerate
+// instances from the ESXi CIM server (sfcb).
+package wbem
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/xml"
+	"esxi_exporter/internal/config"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Instance is a CIM instance flattened to property name/value pairs.
+// Array properties are joined with commas.
+type Instance struct {
+	ClassName  string
+	Properties map[string]string
+}
+
+// Get returns the value of a property or defaultValue when it is missing or null
+func (i Instance) Get(name, defaultValue string) string {
+	if val, ok := i.Properties[name]; ok && val != "" {
+		return val
+	}
+	return defaultValue
+}
+
+// Float parses the value of a numeric property
+func (i Instance) Float(name string) (float64, bool) {
+	val, ok := i.Properties[name]
+	if !ok {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+	if err != nil {
+		return 0, false
+	}
+	return f, true
+}
+
+// Client talks to a single CIMOM
+type Client struct {
+	url        string
+	username   string
+	password   string
+	namespace  string
+	httpClient *http.Client
+}
+
+// NewClient creates a client for the CIM server described by cfg
+func NewClient(cfg config.WbemConfig) *Client {
+	return &Client{
+		url:       strings.TrimSuffix(cfg.URL, "/") + "/cimom",
+		username:  cfg.Username,
+		password:  cfg.Password,
+		namespace: cfg.Namespace,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify},
+			},
+		},
+	}
+}
+
+// EnumerateInstances returns every instance of className and its subclasses
+func (c *Client) EnumerateInstances(className string) ([]Instance, error) {
+	body, err := c.enumerateRequest(className)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(c.username, c.password)
+	req.Header.Set("Content-Type", `application/xml; charset="utf-8"`)
+	req.Header.Set("CIMProtocolVersion", "1.0")
+	req.Header.Set("CIMOperation", "MethodCall")
+	req.Header.Set("CIMMethod", "EnumerateInstances")
+	req.Header.Set("CIMObject", c.namespace)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("EnumerateInstances %s: %s: %s", className, resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var doc cimDocument
+	if err := xml.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("decoding EnumerateInstances %s response: %v", className, err)
+	}
+	response := doc.Message.Response.Method
+	if response.Error != nil {
+		return nil, fmt.Errorf("EnumerateInstances %s: CIM error %s: %s", className, response.Error.Code, response.Error.Description)
+	}
+
+	instances := make([]Instance, 0, len(response.Return.Instances))
+	for _, named := range response.Return.Instances {
+		instance := Instance{
+			ClassName:  named.Instance.ClassName,
+			Properties: make(map[string]string),
+		}
+		for _, prop := range named.Instance.Properties {
+			if prop.Value != nil {
+				instance.Properties[prop.Name] = strings.TrimSpace(*prop.Value)
+			}
+		}
+		for _, prop := range named.Instance.Arrays {
+			values := make([]string, len(prop.Values))
+			for i, value := range prop.Values {
+				values[i] = strings.TrimSpace(value)
+			}
+			instance.Properties[prop.Name] = strings.Join(values, ",")
+		}
+		instances = append(instances, instance)
+	}
+	return instances, nil
+}
+
+// enumerateRequest builds the CIM-XML EnumerateInstances request body
+func (c *Client) enumerateRequest(className string) ([]byte, error) {
+	var namespace strings.Builder
+	for _, part := range strings.Split(c.namespace, "/") {
+		namespace.WriteString(`<NAMESPACE NAME="`)
+		if err := xml.EscapeText(&namespace, []byte(part)); err != nil {
+			return nil, err
+		}
+		namespace.WriteString(`"/>`)
+	}
+	var class bytes.Buffer
+	if err := xml.EscapeText(&class, []byte(className)); err != nil {
+		return nil, err
+	}
+
+	return []byte(`<?xml version="1.0" encoding="utf-8"?>` +
+		`<CIM CIMVERSION="2.0" DTDVERSION="2.0"><MESSAGE ID="1" PROTOCOLVERSION="1.0"><SIMPLEREQ>` +
+		`<IMETHODCALL NAME="EnumerateInstances">` +
+		`<LOCALNAMESPACEPATH>` + namespace.String() + `</LOCALNAMESPACEPATH>` +
+		`<IPARAMVALUE NAME="ClassName"><CLASSNAME NAME="` + class.String() + `"/></IPARAMVALUE>` +
+		`<IPARAMVALUE NAME="DeepInheritance"><VALUE>TRUE</VALUE></IPARAMVALUE>` +
+		`<IPARAMVALUE NAME="LocalOnly"><VALUE>FALSE</VALUE></IPARAMVALUE>` +
+		`<IPARAMVALUE NAME="IncludeQualifiers"><VALUE>FALSE</VALUE></IPARAMVALUE>` +
+		`</IMETHODCALL></SIMPLEREQ></MESSAGE></CIM>`), nil
+}
+
+// cimDocument is the subset of a CIM-XML response used by EnumerateInstances
+type cimDocument struct {
+	Message struct {
+		Response struct {
+			Method struct {
+				Error *struct {
+					Code        string `xml:"CODE,attr"`
+					Description string `xml:"DESCRIPTION,attr"`
+				} `xml:"ERROR"`
+				Return struct {
+					Instances []struct {
+						Instance struct {
+							ClassName  string `xml:"CLASSNAME,attr"`
+							Properties []struct {
+								Name  string  `xml:"NAME,attr"`
+								Value *string `xml:"VALUE"`
+							} `xml:"PROPERTY"`
+							Arrays []struct {
+								Name   string   `xml:"NAME,attr"`
+								Values []string `xml:"VALUE.ARRAY>VALUE"`
+							} `xml:"PROPERTY.ARRAY"`
+						} `xml:"INSTANCE"`
+					} `xml:"VALUE.NAMEDINSTANCE"`
+				} `xml:"IRETURNVALUE"`
+			} `xml:"IMETHODRESPONSE"`
+		} `xml:"SIMPLERSP"`
+	} `xml:"MESSAGE"`
+}
@@ -0,0 +1,104 @@
+package wbem
+
+import (
+	"esxi_exporter/internal/config"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeCIMOM answers EnumerateInstances with the recorded response of the
+// requested class
+func fakeCIMOM(t *testing.T, requests *[]string) *httptest.Server {
+	responses := make(map[string][]byte)
+	for class, fixture := range map[string]string{
+		"CIM_NumericSensor": "numeric_sensors.xml",
+		"CIM_Bogus":         "invalid_class.xml",
+	} {
+		response, err := ioutil.ReadFile(filepath.Join("testdata", fixture))
+		if err != nil {
+			t.Fatal(err)
+		}
+		responses[class] = response
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, _ := r.BasicAuth(); user != "root" || password != "secret" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/cimom" || r.Header.Get("CIMMethod") != "EnumerateInstances" || r.Header.Get("CIMObject") != "root/cimv2" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		*requests = append(*requests, string(body))
+		for class, response := range responses {
+			if strings.Contains(string(body), `<CLASSNAME NAME="`+class+`"/>`) {
+				w.Header().Set("Content-Type", `application/xml; charset="utf-8"`)
+				w.Write(response)
+				return
+			}
+		}
+		http.Error(w, "unexpected class", http.StatusBadRequest)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestEnumerateInstances(t *testing.T) {
+	var requests []string
+	srv := fakeCIMOM(t, &requests)
+	c := NewClient(config.WbemConfig{URL: srv.URL, Username: "root", Password: "secret", Namespace: "root/cimv2"})
+
+	instances, err := c.EnumerateInstances("CIM_NumericSensor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(instances) != 2 {
+		t.Fatalf("got %d instances, want 2", len(instances))
+	}
+
+	inlet := instances[0]
+	if inlet.ClassName != "OMC_NumericSensor" || inlet.Get("ElementName", "") != "System Board 1 Inlet Temp" {
+		t.Errorf("first instance = %+v", inlet)
+	}
+	if reading, ok := inlet.Float("CurrentReading"); !ok || reading != 2300 {
+		t.Errorf("CurrentReading = %v, %v, want 2300", reading, ok)
+	}
+	if got := inlet.Get("OperationalStatus", ""); got != "2,3" {
+		t.Errorf("OperationalStatus = %q, want 2,3", got)
+	}
+	if got := inlet.Get("Caption", "none"); got != "none" {
+		t.Errorf("null Caption = %q, want the default", got)
+	}
+	if reading, ok := instances[1].Float("CurrentReading"); !ok || reading != 6840 {
+		t.Errorf("padded CurrentReading = %v, %v, want 6840", reading, ok)
+	}
+	if _, ok := instances[1].Float("UnitModifier"); ok {
+		t.Errorf("missing UnitModifier parsed")
+	}
+
+	for _, want := range []string{`<NAMESPACE NAME="root"/><NAMESPACE NAME="cimv2"/>`, `<IPARAMVALUE NAME="DeepInheritance"><VALUE>TRUE</VALUE>`} {
+		if !strings.Contains(requests[0], want) {
+			t.Errorf("request lacks %s:\n%s", want, requests[0])
+		}
+	}
+}
+
+func TestEnumerateInstancesErrors(t *testing.T) {
+	var requests []string
+	srv := fakeCIMOM(t, &requests)
+
+	c := NewClient(config.WbemConfig{URL: srv.URL, Username: "root", Password: "secret", Namespace: "root/cimv2"})
+	if _, err := c.EnumerateInstances("CIM_Bogus"); err == nil || !strings.Contains(err.Error(), "CIM error 5: Class not found") {
+		t.Errorf("unknown class: error %v, want CIM error 5", err)
+	}
+
+	c = NewClient(config.WbemConfig{URL: srv.URL, Username: "root", Password: "wrong", Namespace: "root/cimv2"})
+	if _, err := c.EnumerateInstances("CIM_NumericSensor"); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("wrong password: error %v, want a 401", err)
+	}
+}
@@ -1,38 +1,159 @@
 package main
 
 import (
+	"context"
+	"esxi_exporter/internal/config"
+	"esxi_exporter/internal/executor"
 	"esxi_exporter/internal/metrics"
+	"esxi_exporter/internal/probe"
+	"flag"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/exporter-toolkit/web"
 )
 
+// shutdownTimeout bounds how long in-flight requests are drained on shutdown,
+// after their commands have been killed
+const shutdownTimeout = 30 * time.Second
+
 func main() {
-	port := "10424"
+	// `esxi_exporter check` runs as a Nagios plugin instead of an exporter
+	// and `esxi_exporter generate` writes alerting rules or a dashboard
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "check":
+			os.Exit(runCheck(os.Args[2:]))
+		case "generate":
+			os.Exit(runGenerate(os.Args[2:]))
+		}
+	}
 
-	// Hours to rescan
-	rescanInterval := 24 // 1 days
+	configFile := flag.String("config.file", "", "Path to the exporter configuration file")
+	listenAddress := flag.String("web.listen-address", "0.0.0.0:10424", "Address to listen on for the web interface and telemetry")
+	webConfigFile := flag.String("web.config.file", "", "Path to a web configuration file enabling TLS and/or basic authentication")
+	textfile := flag.String("output.textfile", "", "Write metrics to this file for the node_exporter textfile collector instead of serving them")
+	textfileInterval := flag.Duration("output.textfile.interval", 0, "Rewrite --output.textfile at this interval; collect once and exit when 0")
+	gatewayURL := flag.String("push.gateway-url", "", "Push metrics to this Pushgateway instead of serving them")
+	remoteWriteURL := flag.String("push.remote-write-url", "", "Send metrics to this Prometheus remote_write endpoint instead of serving them")
+	pushInterval := flag.Duration("push.interval", 0, "Collect and push at this interval; push once and exit when 0")
+	flag.Parse()
+
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
 
 	// Create PercMetrics instance and run it
-	pm := metrics.NewMetrics()
+	pm, err := metrics.NewMetrics(cfg, executor.Local{}, cfg.Collectors)
+	if err != nil {
+		log.Fatalf("Failed to set up collectors: %v", err)
+	}
 
-	// Run metrics collection in a goroutine
-	go func() {
-		ticker := time.NewTicker(time.Duration(rescanInterval) * time.Hour)
-		defer ticker.Stop()
+	// Textfile and push modes collect and write out metrics instead of serving them
+	pushing := *gatewayURL != "" || *remoteWriteURL != ""
+	if *textfile != "" && pushing {
+		log.Fatalf("--output.textfile and --push.* are mutually exclusive")
+	}
+	if *textfile != "" || pushing {
+		ctx, cancel := context.WithCancel(context.Background())
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-signals
+			cancel()
+		}()
 
-		for runtime := range ticker.C {
-			log.Printf("Rescan metrics at: %v", runtime)
-			pm.CollectMetrics()
+		write, interval := writeTextfile(pm, *textfile), *textfileInterval
+		if pushing {
+			write, interval = pushMetrics(ctx, pm, *gatewayURL, *remoteWriteURL), *pushInterval
+		}
+		if err := runOutput(ctx, pm, interval, write); err != nil {
+			log.Fatalf("Failed to write metrics: %v", err)
 		}
+		return
+	}
+
+	// Remote ESXi hosts are probed over SSH via /probe
+	pool := executor.NewPool(cfg.Targets)
+	defer pool.Close()
+
+	// Run every collector on its own schedule until shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	collectorsDone := make(chan struct{})
+	go func() {
+		pm.Run(ctx)
+		close(collectorsDone)
 	}()
 
+	probeHandler := probe.NewHandler(cfg, pool)
+	reload := &reloader{configFile: *configFile, metrics: pm, probeHandler: probeHandler, pool: pool}
+
 	// Set up the /metrics endpoint
-	http.Handle("/metrics", promhttp.Handler())
-	log.Printf("Starting server on port %s", port)
-	if err := http.ListenAndServe("0.0.0.0:"+port, nil); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	http.Handle("/metrics", promhttp.HandlerFor(pm.Gatherer(), promhttp.HandlerOpts{}))
+	http.Handle("/probe", probeHandler)
+	http.Handle("/", landingHandler(pm))
+	http.HandleFunc("/-/healthy", healthyHandler)
+	http.Handle("/-/ready", readyHandler(pm))
+	http.Handle("/-/reload", reload)
+	http.Handle("/api/v1/inventory", inventoryHandler(pm))
+	http.Handle("/api/v1/health", healthHandler(pm))
+	log.Printf("Starting server on %s", *listenAddress)
+	// Requests inherit ctx so shutdown also cancels the commands of probes
+	server := &http.Server{Addr: *listenAddress, BaseContext: func(net.Listener) context.Context { return ctx }}
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- web.ListenAndServe(server, *webConfigFile, toolkitLogger{})
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	for {
+		select {
+		case err := <-serverErr:
+			log.Fatalf("Failed to start server: %v", err)
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				if err := reload.reload(); err != nil {
+					log.Printf("Error reloading configuration: %v", err)
+				}
+				continue
+			}
+
+			// Kill running commands first so collections and probes return
+			// right away, then drain HTTP and wait for the collectors
+			log.Printf("Received %v, shutting down", sig)
+			cancel()
+			shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			if err := server.Shutdown(shutdownCtx); err != nil {
+				log.Printf("Error draining HTTP connections: %v", err)
+			}
+			shutdownCancel()
+			<-collectorsDone
+			return
+		}
+	}
+}
+
+// toolkitLogger forwards exporter-toolkit key/value log lines to the standard logger
+type toolkitLogger struct{}
+
+func (toolkitLogger) Log(keyvals ...interface{}) error {
+	var line strings.Builder
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		if i > 0 {
+			line.WriteString(" ")
+		}
+		fmt.Fprintf(&line, "%v=%q", keyvals[i], fmt.Sprint(keyvals[i+1]))
 	}
+	log.Print(line.String())
+	return nil
 }
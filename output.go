@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"esxi_exporter/internal/metrics"
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// runOutput collects the metrics and hands them to write, once when
+// interval is zero and otherwise every interval until ctx is done. Used by
+// the textfile and push modes, where the exporter isn't scraped.
+func runOutput(ctx context.Context, pm *metrics.Metrics, interval time.Duration, write func() error) error {
+	for {
+		pm.CollectMetrics(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err := write(); err != nil {
+			if interval == 0 {
+				return err
+			}
+			log.Printf("Error writing metrics: %v", err)
+		}
+		if interval == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// writeTextfile replaces path atomically with the collected metrics
+func writeTextfile(pm *metrics.Metrics, path string) func() error {
+	return func() error {
+		if err := prometheus.WriteToTextfile(path, pm.Gatherer()); err != nil {
+			return err
+		}
+		log.Printf("Wrote metrics to %s", path)
+		return nil
+	}
+}
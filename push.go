@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"esxi_exporter/internal/metrics"
+	"esxi_exporter/internal/remotewrite"
+	"esxi_exporter/internal/retry"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// pushJob is the job label of pushed metrics
+const pushJob = "esxi_exporter"
+
+// pushRetry bounds the retries of both push paths
+var pushRetry = retry.Default
+
+// pushMetrics sends the collected metrics to a Pushgateway, replacing the
+// group of the host, and/or to a remote_write endpoint
+func pushMetrics(ctx context.Context, pm *metrics.Metrics, gatewayURL, remoteWriteURL string) func() error {
+	var remoteWrite *remotewrite.Client
+	if remoteWriteURL != "" {
+		remoteWrite = remotewrite.NewClient(remoteWriteURL)
+		remoteWrite.Retry = pushRetry
+	}
+	gateway := gatewayClient{ctx: ctx, client: &http.Client{Timeout: 30 * time.Second}}
+
+	return func() error {
+		host := pm.Host()
+		var errs []error
+
+		if gatewayURL != "" {
+			// The instance label groups by host; host is taken by smartctl metrics
+			pusher := push.New(gatewayURL, pushJob).Grouping("instance", host).Gatherer(pm.Gatherer()).Client(gateway)
+			if err := pushRetry.Do(ctx, "Push to "+gatewayURL, pusher.Push); err != nil {
+				errs = append(errs, fmt.Errorf("pushing to %s: %v", gatewayURL, err))
+			} else {
+				log.Printf("Pushed metrics of %s to %s", host, gatewayURL)
+			}
+		}
+
+		if remoteWrite != nil {
+			families, err := pm.Gatherer().Gather()
+			if err == nil {
+				err = remoteWrite.Write(ctx, families, map[string]string{"job": pushJob, "instance": host}, time.Now())
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("remote writing to %s: %v", remoteWriteURL, err))
+			} else {
+				log.Printf("Sent metrics of %s to %s", host, remoteWriteURL)
+			}
+		}
+
+		if len(errs) > 0 {
+			return fmt.Errorf("%v", errs)
+		}
+		return nil
+	}
+}
+
+// gatewayClient sends Pushgateway requests under ctx. Network errors, 5xx
+// and 429 responses are marked recoverable so that only those are retried.
+type gatewayClient struct {
+	ctx    context.Context
+	client *http.Client
+}
+
+func (c gatewayClient) Do(req *http.Request) (*http.Response, error) {
+	resp, err := c.client.Do(req.WithContext(c.ctx))
+	if err != nil {
+		return nil, retry.Recoverable(err)
+	}
+	if retry.RecoverableStatus(resp.StatusCode) {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, retry.Recoverable(fmt.Errorf("%s %s: %s: %s", req.Method, req.URL, resp.Status, strings.TrimSpace(string(msg))))
+	}
+	return resp, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"esxi_exporter/internal/config"
+	"esxi_exporter/internal/executor"
+	"esxi_exporter/internal/metrics"
+	"esxi_exporter/internal/retry"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// failingExecutor fails every command, leaving only collector_success and
+// collector_duration_seconds to push
+type failingExecutor struct{}
+
+func (failingExecutor) Run(ctx context.Context, command executor.Command) (string, error) {
+	return "", fmt.Errorf("%s: not available", command)
+}
+
+func newTestMetrics(t *testing.T) *metrics.Metrics {
+	t.Helper()
+	pm, err := metrics.NewMetrics(config.Default(), failingExecutor{}, []string{"storage"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm.CollectMetrics(context.Background())
+	return pm
+}
+
+// withFastRetries shortens the push backoff for the duration of a test
+func withFastRetries(t *testing.T) {
+	saved := pushRetry
+	pushRetry = retry.Policy{Retries: 3, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	t.Cleanup(func() { pushRetry = saved })
+}
+
+func TestPushGateway(t *testing.T) {
+	withFastRetries(t)
+	var method, path string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	pm := newTestMetrics(t)
+	if err := pushMetrics(context.Background(), pm, srv.URL, "")(); err != nil {
+		t.Fatal(err)
+	}
+	if method != http.MethodPut || path != "/metrics/job/esxi_exporter/instance/"+pm.Host() {
+		t.Errorf("got %s %s, want PUT /metrics/job/esxi_exporter/instance/%s", method, path, pm.Host())
+	}
+}
+
+func TestPushGatewayRetries(t *testing.T) {
+	withFastRetries(t)
+	for _, tc := range []struct {
+		statuses  []int
+		wantCalls int
+		wantErr   bool
+	}{
+		{[]int{http.StatusServiceUnavailable, http.StatusOK}, 2, false},
+		{[]int{http.StatusTooManyRequests, http.StatusAccepted}, 2, false},
+		{[]int{http.StatusBadRequest}, 1, true},
+		{[]int{500, 500, 500, 500}, 4, true},
+	} {
+		var mtx sync.Mutex
+		calls := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mtx.Lock()
+			defer mtx.Unlock()
+			w.WriteHeader(tc.statuses[calls])
+			calls++
+		}))
+
+		err := pushMetrics(context.Background(), newTestMetrics(t), srv.URL, "")()
+		srv.Close()
+		if calls != tc.wantCalls || (err != nil) != tc.wantErr {
+			t.Errorf("statuses %v: got %d calls and error %v, want %d calls and error %v", tc.statuses, calls, err, tc.wantCalls, tc.wantErr)
+		}
+	}
+}